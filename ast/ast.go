@@ -2,6 +2,7 @@ package ast
 
 import (
 	"bytes"
+	"strings"
 
 	"github.com/shavit/go-interpreter/token"
 )
@@ -178,6 +179,48 @@ func (il *IntegerLiteral) String() string {
 	return il.Token.Literal
 }
 
+// FloatLiteral implements the Expression interface
+type FloatLiteral struct {
+	Token token.Token
+	Value float64
+}
+
+// expressionNode() returns the expression node
+func (fl *FloatLiteral) expressionNode() {
+}
+
+// TokenLiteral() returns the float token literal
+func (fl *FloatLiteral) TokenLiteral() string {
+	return fl.Token.Literal
+}
+
+// String() returns the float literal as written in the source
+func (fl *FloatLiteral) String() string {
+	return fl.Token.Literal
+}
+
+// StringLiteral implements the Expression interface
+// The token literal is the source of the string, with its quotes and
+//  escape sequences, while the value is decoded
+type StringLiteral struct {
+	Token token.Token
+	Value string
+}
+
+// expressionNode() returns the expression node
+func (sl *StringLiteral) expressionNode() {
+}
+
+// TokenLiteral() returns the string token literal
+func (sl *StringLiteral) TokenLiteral() string {
+	return sl.Token.Literal
+}
+
+// String() returns the string literal as written in the source
+func (sl *StringLiteral) String() string {
+	return sl.Token.Literal
+}
+
 // PrefixExpression implements the Expression interface
 type PrefixExpression struct {
 	Operator string
@@ -236,6 +279,32 @@ func (oe *InfixExpression) String() string {
 	return out.String()
 }
 
+// LogicalExpression implements the Expression interface
+// It is separate from InfixExpression, since the right expression is
+//  only evaluated when the left one does not decide the result
+type LogicalExpression struct {
+	// The && or || token
+	Token    token.Token
+	Left     Expression
+	Operator string
+	Right    Expression
+}
+
+// expressionNode() returns the expression node
+func (le *LogicalExpression) expressionNode() {
+}
+
+// TokenLiteral() returns the token literal
+func (le *LogicalExpression) TokenLiteral() string {
+	return le.Token.Literal
+}
+
+// String() returns the string representation, in parentheses like
+//  infix expressions
+func (le *LogicalExpression) String() string {
+	return "(" + le.Left.String() + " " + le.Operator + " " + le.Right.String() + ")"
+}
+
 // BooleanLiteral implements the Expression interface
 type BooleanLiteral struct {
 	Token token.Token
@@ -255,3 +324,263 @@ func (b *BooleanLiteral) TokenLiteral() string {
 func (b *BooleanLiteral) String() string {
 	return b.Token.Literal
 }
+
+// IfExpression implements the Expression interface
+// The alternative is nil when there is no else block
+type IfExpression struct {
+	Token       token.Token
+	Condition   Expression
+	Consequence *BlockStatement
+	Alternative *BlockStatement
+}
+
+// expressionNode() returns the expression node
+func (ie *IfExpression) expressionNode() {
+}
+
+// TokenLiteral() returns the if token literal
+func (ie *IfExpression) TokenLiteral() string {
+	return ie.Token.Literal
+}
+
+// String() returns the string representation
+func (ie *IfExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("if")
+	out.WriteString(ie.Condition.String())
+	out.WriteString(" ")
+	out.WriteString(ie.Consequence.String())
+
+	if ie.Alternative != nil {
+		out.WriteString(" else ")
+		out.WriteString(ie.Alternative.String())
+	}
+
+	return out.String()
+}
+
+// BlockStatement is a list of statements between braces
+type BlockStatement struct {
+	// The { token
+	Token      token.Token
+	Statements []Statement
+}
+
+// statementNode is a helper that checks that this is a statement
+func (bs *BlockStatement) statementNode() {
+}
+
+// TokenLiteral returns the token literal
+func (bs *BlockStatement) TokenLiteral() string {
+	return bs.Token.Literal
+}
+
+// String prints AST nodes for debugging
+func (bs *BlockStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("{ ")
+	for _, s := range bs.Statements {
+		out.WriteString(s.String())
+	}
+	out.WriteString(" }")
+
+	return out.String()
+}
+
+// FunctionLiteral implements the Expression interface
+type FunctionLiteral struct {
+	// The fn token
+	Token      token.Token
+	Parameters []*Identifier
+	Body       *BlockStatement
+}
+
+// expressionNode() returns the expression node
+func (fl *FunctionLiteral) expressionNode() {
+}
+
+// TokenLiteral() returns the fn token literal
+func (fl *FunctionLiteral) TokenLiteral() string {
+	return fl.Token.Literal
+}
+
+// String() returns the string representation
+func (fl *FunctionLiteral) String() string {
+	var out bytes.Buffer
+
+	params := []string{}
+	for _, p := range fl.Parameters {
+		params = append(params, p.String())
+	}
+
+	out.WriteString(fl.TokenLiteral())
+	out.WriteString("(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") ")
+	out.WriteString(fl.Body.String())
+
+	return out.String()
+}
+
+// CallExpression implements the Expression interface
+// The function is either an identifier or a function literal
+type CallExpression struct {
+	// The ( token
+	Token     token.Token
+	Function  Expression
+	Arguments []Expression
+}
+
+// expressionNode() returns the expression node
+func (ce *CallExpression) expressionNode() {
+}
+
+// TokenLiteral() returns the token literal
+func (ce *CallExpression) TokenLiteral() string {
+	return ce.Token.Literal
+}
+
+// String() returns the string representation
+func (ce *CallExpression) String() string {
+	var out bytes.Buffer
+
+	args := []string{}
+	for _, a := range ce.Arguments {
+		args = append(args, a.String())
+	}
+
+	out.WriteString(ce.Function.String())
+	out.WriteString("(")
+	out.WriteString(strings.Join(args, ", "))
+	out.WriteString(")")
+
+	return out.String()
+}
+
+// ArrayLiteral implements the Expression interface
+type ArrayLiteral struct {
+	// The [ token
+	Token    token.Token
+	Elements []Expression
+}
+
+// expressionNode() returns the expression node
+func (al *ArrayLiteral) expressionNode() {
+}
+
+// TokenLiteral() returns the token literal
+func (al *ArrayLiteral) TokenLiteral() string {
+	return al.Token.Literal
+}
+
+// String() returns the elements between brackets
+func (al *ArrayLiteral) String() string {
+	elements := []string{}
+	for _, el := range al.Elements {
+		elements = append(elements, el.String())
+	}
+
+	return "[" + strings.Join(elements, ", ") + "]"
+}
+
+// IndexExpression implements the Expression interface
+// The left expression is any expression that evaluates to an array
+type IndexExpression struct {
+	// The [ token
+	Token token.Token
+	Left  Expression
+	Index Expression
+}
+
+// expressionNode() returns the expression node
+func (ie *IndexExpression) expressionNode() {
+}
+
+// TokenLiteral() returns the token literal
+func (ie *IndexExpression) TokenLiteral() string {
+	return ie.Token.Literal
+}
+
+// String() returns the string representation, in parentheses like
+//  infix expressions
+func (ie *IndexExpression) String() string {
+	return "(" + ie.Left.String() + "[" + ie.Index.String() + "])"
+}
+
+// HashLiteral implements the Expression interface
+// The pairs keep the order of the source
+type HashLiteral struct {
+	// The { token
+	Token token.Token
+	Pairs []HashPair
+}
+
+// HashPair is a key and its value in a hash literal
+type HashPair struct {
+	Key   Expression
+	Value Expression
+}
+
+// expressionNode() returns the expression node
+func (hl *HashLiteral) expressionNode() {
+}
+
+// TokenLiteral() returns the token literal
+func (hl *HashLiteral) TokenLiteral() string {
+	return hl.Token.Literal
+}
+
+// String() returns the pairs between braces
+func (hl *HashLiteral) String() string {
+	pairs := []string{}
+	for _, pair := range hl.Pairs {
+		pairs = append(pairs, pair.Key.String()+": "+pair.Value.String())
+	}
+
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
+
+// BadStatement is a placeholder for a statement with syntax errors
+// It spans the tokens the parser skipped to recover from the errors
+type BadStatement struct {
+	// The first token of the statement
+	Token token.Token
+	// The position right after the last skipped token
+	End token.Position
+}
+
+// statementNode checks that this is a statement node
+func (bs *BadStatement) statementNode() {
+}
+
+// TokenLiteral returns the literal of the first token
+func (bs *BadStatement) TokenLiteral() string {
+	return bs.Token.Literal
+}
+
+// String returns a placeholder, since the statement has no valid source
+func (bs *BadStatement) String() string {
+	return "<bad statement>"
+}
+
+// BadExpression is a placeholder for an expression with syntax errors
+type BadExpression struct {
+	// The token where the expression was expected
+	Token token.Token
+}
+
+// expressionNode checks that this is an expression node
+func (be *BadExpression) expressionNode() {
+}
+
+// TokenLiteral returns the literal of the token
+func (be *BadExpression) TokenLiteral() string {
+	return be.Token.Literal
+}
+
+// String returns a placeholder, since the expression has no valid source
+func (be *BadExpression) String() string {
+	return "<bad expression>"
+}
@@ -0,0 +1,546 @@
+package ast
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/shavit/go-interpreter/token"
+)
+
+// jsonNode is the JSON encoding of every node
+// The kind is the name of the node type, and only the fields of that
+//  type are set. The value is either a literal value, or the value
+//  expression of a let statement
+type jsonNode struct {
+	Kind  string       `json:"kind"`
+	Token *token.Token `json:"token,omitempty"`
+
+	Value    json.RawMessage `json:"value,omitempty"`
+	End      *token.Position `json:"end,omitempty"`
+	Operator string          `json:"operator,omitempty"`
+
+	Name        *jsonNode   `json:"name,omitempty"`
+	LetValue    *jsonNode   `json:"letValue,omitempty"`
+	ReturnValue *jsonNode   `json:"returnValue,omitempty"`
+	Expression  *jsonNode   `json:"expression,omitempty"`
+	Left        *jsonNode   `json:"left,omitempty"`
+	Right       *jsonNode   `json:"right,omitempty"`
+	Condition   *jsonNode   `json:"condition,omitempty"`
+	Consequence *jsonNode   `json:"consequence,omitempty"`
+	Alternative *jsonNode   `json:"alternative,omitempty"`
+	Function    *jsonNode   `json:"function,omitempty"`
+	Body        *jsonNode   `json:"body,omitempty"`
+	Statements  []*jsonNode `json:"statements,omitempty"`
+	Parameters  []*jsonNode `json:"parameters,omitempty"`
+	Arguments   []*jsonNode `json:"arguments,omitempty"`
+	Elements    []*jsonNode `json:"elements,omitempty"`
+	Index       *jsonNode   `json:"index,omitempty"`
+	Pairs       []jsonPair  `json:"pairs,omitempty"`
+}
+
+// jsonPair is the JSON encoding of a pair of a hash literal
+type jsonPair struct {
+	Key   *jsonNode `json:"key"`
+	Value *jsonNode `json:"value"`
+}
+
+// MarshalJSON encodes a node and its children
+// Every node has a "kind" discriminator and its token, so the tree can
+//  be decoded with UnmarshalJSON
+func MarshalJSON(node Node) ([]byte, error) {
+	n, err := encodeNode(node)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(n)
+}
+
+// UnmarshalJSON decodes a node encoded by MarshalJSON
+func UnmarshalJSON(data []byte) (Node, error) {
+	var n *jsonNode
+	if err := json.Unmarshal(data, &n); err != nil {
+		return nil, err
+	}
+
+	return decodeNode(n)
+}
+
+// MarshalJSON encodes the program with MarshalJSON
+func (p *Program) MarshalJSON() ([]byte, error) {
+	return MarshalJSON(p)
+}
+
+// UnmarshalJSON decodes a program encoded by MarshalJSON
+func (p *Program) UnmarshalJSON(data []byte) error {
+	node, err := UnmarshalJSON(data)
+	if err != nil {
+		return err
+	}
+
+	program, ok := node.(*Program)
+	if !ok {
+		return fmt.Errorf("ast: found %T, while expecting a program", node)
+	}
+	*p = *program
+
+	return nil
+}
+
+// encodeNode converts a node to its JSON encoding
+// Nil nodes are encoded as null
+func encodeNode(node Node) (*jsonNode, error) {
+	var err error
+	var n *jsonNode
+
+	switch node := node.(type) {
+	case nil:
+		return nil, nil
+
+	// Statements
+	case *Program:
+		n = &jsonNode{Kind: "Program"}
+		n.Statements, err = encodeStatements(node.Statements)
+	case *LetStatement:
+		n = &jsonNode{Kind: "LetStatement", Token: &node.Token}
+		if node.Name != nil {
+			n.Name, err = encodeNode(node.Name)
+		}
+		if err == nil {
+			n.LetValue, err = encodeExpression(node.Value)
+		}
+	case *ReturnStatement:
+		n = &jsonNode{Kind: "ReturnStatement", Token: &node.Token}
+		n.ReturnValue, err = encodeExpression(node.ReturnValue)
+	case *ExpressionStatement:
+		n = &jsonNode{Kind: "ExpressionStatement", Token: &node.Token}
+		n.Expression, err = encodeExpression(node.Expression)
+	case *BlockStatement:
+		n = &jsonNode{Kind: "BlockStatement", Token: &node.Token}
+		n.Statements, err = encodeStatements(node.Statements)
+	case *BadStatement:
+		n = &jsonNode{Kind: "BadStatement", Token: &node.Token, End: &node.End}
+
+	// Expressions
+	case *Identifier:
+		n = &jsonNode{Kind: "Identifier", Token: &node.Token}
+		n.Value, err = json.Marshal(node.Value)
+	case *IntegerLiteral:
+		n = &jsonNode{Kind: "IntegerLiteral", Token: &node.Token}
+		n.Value, err = json.Marshal(node.Value)
+	case *FloatLiteral:
+		n = &jsonNode{Kind: "FloatLiteral", Token: &node.Token}
+		n.Value, err = json.Marshal(node.Value)
+	case *StringLiteral:
+		n = &jsonNode{Kind: "StringLiteral", Token: &node.Token}
+		n.Value, err = json.Marshal(node.Value)
+	case *BooleanLiteral:
+		n = &jsonNode{Kind: "BooleanLiteral", Token: &node.Token}
+		n.Value, err = json.Marshal(node.Value)
+	case *PrefixExpression:
+		n = &jsonNode{Kind: "PrefixExpression", Token: &node.Token, Operator: node.Operator}
+		n.Right, err = encodeExpression(node.Right)
+	case *InfixExpression:
+		n = &jsonNode{Kind: "InfixExpression", Token: &node.Token, Operator: node.Operator}
+		if n.Left, err = encodeExpression(node.Left); err == nil {
+			n.Right, err = encodeExpression(node.Right)
+		}
+	case *LogicalExpression:
+		n = &jsonNode{Kind: "LogicalExpression", Token: &node.Token, Operator: node.Operator}
+		if n.Left, err = encodeExpression(node.Left); err == nil {
+			n.Right, err = encodeExpression(node.Right)
+		}
+	case *IfExpression:
+		n = &jsonNode{Kind: "IfExpression", Token: &node.Token}
+		if n.Condition, err = encodeExpression(node.Condition); err != nil {
+			break
+		}
+		if node.Consequence != nil {
+			if n.Consequence, err = encodeNode(node.Consequence); err != nil {
+				break
+			}
+		}
+		if node.Alternative != nil {
+			n.Alternative, err = encodeNode(node.Alternative)
+		}
+	case *FunctionLiteral:
+		n = &jsonNode{Kind: "FunctionLiteral", Token: &node.Token, Parameters: []*jsonNode{}}
+		for _, p := range node.Parameters {
+			param, err := encodeNode(p)
+			if err != nil {
+				return nil, err
+			}
+			n.Parameters = append(n.Parameters, param)
+		}
+		if node.Body != nil {
+			n.Body, err = encodeNode(node.Body)
+		}
+	case *CallExpression:
+		n = &jsonNode{Kind: "CallExpression", Token: &node.Token}
+		if n.Function, err = encodeExpression(node.Function); err == nil {
+			n.Arguments, err = encodeExpressions(node.Arguments)
+		}
+	case *ArrayLiteral:
+		n = &jsonNode{Kind: "ArrayLiteral", Token: &node.Token}
+		n.Elements, err = encodeExpressions(node.Elements)
+	case *HashLiteral:
+		n = &jsonNode{Kind: "HashLiteral", Token: &node.Token}
+		n.Pairs, err = encodePairs(node.Pairs)
+	case *IndexExpression:
+		n = &jsonNode{Kind: "IndexExpression", Token: &node.Token}
+		if n.Left, err = encodeExpression(node.Left); err == nil {
+			n.Index, err = encodeExpression(node.Index)
+		}
+	case *BadExpression:
+		n = &jsonNode{Kind: "BadExpression", Token: &node.Token}
+
+	default:
+		return nil, fmt.Errorf("ast: cannot encode node type %T", node)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return n, nil
+}
+
+// encodeExpression encodes an optional expression
+func encodeExpression(e Expression) (*jsonNode, error) {
+	if e == nil {
+		return nil, nil
+	}
+
+	return encodeNode(e)
+}
+
+// encodeStatements encodes a list of statements
+func encodeStatements(list []Statement) ([]*jsonNode, error) {
+	nodes := []*jsonNode{}
+	for _, s := range list {
+		n, err := encodeNode(s)
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, n)
+	}
+
+	return nodes, nil
+}
+
+// encodeExpressions encodes a list of expressions
+func encodeExpressions(list []Expression) ([]*jsonNode, error) {
+	nodes := []*jsonNode{}
+	for _, e := range list {
+		n, err := encodeExpression(e)
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, n)
+	}
+
+	return nodes, nil
+}
+
+// encodePairs encodes the pairs of a hash literal
+func encodePairs(pairs []HashPair) ([]jsonPair, error) {
+	nodes := []jsonPair{}
+	for _, pair := range pairs {
+		key, err := encodeExpression(pair.Key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := encodeExpression(pair.Value)
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, jsonPair{Key: key, Value: value})
+	}
+
+	return nodes, nil
+}
+
+// decodeNode converts the JSON encoding back to a node
+// Nodes without the children they cannot be without are errors, so the
+//  decoded tree is safe to print and evaluate
+func decodeNode(n *jsonNode) (Node, error) {
+	if n == nil {
+		return nil, nil
+	}
+
+	var err error
+
+	switch n.Kind {
+	// Statements
+	case "Program":
+		node := &Program{}
+		node.Statements, err = decodeStatements(n.Statements)
+		return node, err
+	case "LetStatement":
+		node := &LetStatement{Token: tokenOf(n)}
+		if n.Name == nil {
+			return nil, missing(n, "name")
+		}
+		if node.Name, err = decodeIdentifier(n.Name); err != nil {
+			return nil, err
+		}
+		node.Value, err = decodeExpression(n.LetValue)
+		return node, err
+	case "ReturnStatement":
+		node := &ReturnStatement{Token: tokenOf(n)}
+		node.ReturnValue, err = decodeExpression(n.ReturnValue)
+		return node, err
+	case "ExpressionStatement":
+		node := &ExpressionStatement{Token: tokenOf(n)}
+		node.Expression, err = decodeExpression(n.Expression)
+		return node, err
+	case "BlockStatement":
+		node := &BlockStatement{Token: tokenOf(n)}
+		node.Statements, err = decodeStatements(n.Statements)
+		return node, err
+	case "BadStatement":
+		node := &BadStatement{Token: tokenOf(n)}
+		if n.End != nil {
+			node.End = *n.End
+		}
+		return node, nil
+
+	// Expressions
+	case "Identifier":
+		node := &Identifier{Token: tokenOf(n)}
+		err = decodeValue(n, &node.Value)
+		return node, err
+	case "IntegerLiteral":
+		node := &IntegerLiteral{Token: tokenOf(n)}
+		err = decodeValue(n, &node.Value)
+		return node, err
+	case "FloatLiteral":
+		node := &FloatLiteral{Token: tokenOf(n)}
+		err = decodeValue(n, &node.Value)
+		return node, err
+	case "StringLiteral":
+		node := &StringLiteral{Token: tokenOf(n)}
+		err = decodeValue(n, &node.Value)
+		return node, err
+	case "BooleanLiteral":
+		node := &BooleanLiteral{Token: tokenOf(n)}
+		err = decodeValue(n, &node.Value)
+		return node, err
+	case "PrefixExpression":
+		node := &PrefixExpression{Token: tokenOf(n), Operator: n.Operator}
+		node.Right, err = decodeRequired(n, n.Right, "right")
+		return node, err
+	case "InfixExpression":
+		node := &InfixExpression{Token: tokenOf(n), Operator: n.Operator}
+		if node.Left, err = decodeRequired(n, n.Left, "left"); err != nil {
+			return nil, err
+		}
+		node.Right, err = decodeRequired(n, n.Right, "right")
+		return node, err
+	case "LogicalExpression":
+		node := &LogicalExpression{Token: tokenOf(n), Operator: n.Operator}
+		if node.Left, err = decodeRequired(n, n.Left, "left"); err != nil {
+			return nil, err
+		}
+		node.Right, err = decodeRequired(n, n.Right, "right")
+		return node, err
+	case "IfExpression":
+		node := &IfExpression{Token: tokenOf(n)}
+		if node.Condition, err = decodeRequired(n, n.Condition, "condition"); err != nil {
+			return nil, err
+		}
+		if n.Consequence == nil {
+			return nil, missing(n, "consequence")
+		}
+		if node.Consequence, err = decodeBlock(n.Consequence); err != nil {
+			return nil, err
+		}
+		node.Alternative, err = decodeBlock(n.Alternative)
+		return node, err
+	case "FunctionLiteral":
+		node := &FunctionLiteral{Token: tokenOf(n), Parameters: []*Identifier{}}
+		for _, p := range n.Parameters {
+			if p == nil {
+				return nil, missing(n, "parameter")
+			}
+			param, err := decodeIdentifier(p)
+			if err != nil {
+				return nil, err
+			}
+			node.Parameters = append(node.Parameters, param)
+		}
+		if n.Body == nil {
+			return nil, missing(n, "body")
+		}
+		node.Body, err = decodeBlock(n.Body)
+		return node, err
+	case "CallExpression":
+		node := &CallExpression{Token: tokenOf(n)}
+		if node.Function, err = decodeRequired(n, n.Function, "function"); err != nil {
+			return nil, err
+		}
+		node.Arguments, err = decodeExpressions(n.Arguments)
+		return node, err
+	case "ArrayLiteral":
+		node := &ArrayLiteral{Token: tokenOf(n)}
+		node.Elements, err = decodeExpressions(n.Elements)
+		return node, err
+	case "HashLiteral":
+		node := &HashLiteral{Token: tokenOf(n)}
+		node.Pairs, err = decodePairs(n.Pairs)
+		return node, err
+	case "IndexExpression":
+		node := &IndexExpression{Token: tokenOf(n)}
+		if node.Left, err = decodeRequired(n, n.Left, "left"); err != nil {
+			return nil, err
+		}
+		node.Index, err = decodeRequired(n, n.Index, "index")
+		return node, err
+	case "BadExpression":
+		return &BadExpression{Token: tokenOf(n)}, nil
+
+	default:
+		return nil, fmt.Errorf("ast: unknown node kind %q", n.Kind)
+	}
+}
+
+// tokenOf returns the token of an encoded node
+// The program is the only node without a token
+func tokenOf(n *jsonNode) token.Token {
+	if n.Token == nil {
+		return token.Token{}
+	}
+
+	return *n.Token
+}
+
+// decodeValue decodes the literal value of a node
+func decodeValue(n *jsonNode, v interface{}) error {
+	if len(n.Value) == 0 {
+		return fmt.Errorf("ast: %s has no value", n.Kind)
+	}
+
+	return json.Unmarshal(n.Value, v)
+}
+
+// decodeExpression decodes an optional expression
+func decodeExpression(n *jsonNode) (Expression, error) {
+	node, err := decodeNode(n)
+	if err != nil || node == nil {
+		return nil, err
+	}
+
+	exp, ok := node.(Expression)
+	if !ok {
+		return nil, fmt.Errorf("ast: found %s, while expecting an expression", n.Kind)
+	}
+
+	return exp, nil
+}
+
+// decodeRequired decodes an expression that a node cannot be without
+func decodeRequired(parent, n *jsonNode, field string) (Expression, error) {
+	if n == nil {
+		return nil, missing(parent, field)
+	}
+
+	return decodeExpression(n)
+}
+
+// missing returns the error of a node without one of its children
+func missing(n *jsonNode, field string) error {
+	return fmt.Errorf("ast: %s has no %s", n.Kind, field)
+}
+
+// decodeIdentifier decodes an optional identifier
+func decodeIdentifier(n *jsonNode) (*Identifier, error) {
+	node, err := decodeNode(n)
+	if err != nil || node == nil {
+		return nil, err
+	}
+
+	ident, ok := node.(*Identifier)
+	if !ok {
+		return nil, fmt.Errorf("ast: found %s, while expecting an identifier", n.Kind)
+	}
+
+	return ident, nil
+}
+
+// decodeBlock decodes an optional block
+func decodeBlock(n *jsonNode) (*BlockStatement, error) {
+	node, err := decodeNode(n)
+	if err != nil || node == nil {
+		return nil, err
+	}
+
+	block, ok := node.(*BlockStatement)
+	if !ok {
+		return nil, fmt.Errorf("ast: found %s, while expecting a block", n.Kind)
+	}
+
+	return block, nil
+}
+
+// decodeStatements decodes a list of statements
+func decodeStatements(list []*jsonNode) ([]Statement, error) {
+	statements := []Statement{}
+	for _, n := range list {
+		if n == nil {
+			return nil, fmt.Errorf("ast: found null, while expecting a statement")
+		}
+
+		node, err := decodeNode(n)
+		if err != nil {
+			return nil, err
+		}
+
+		stmt, ok := node.(Statement)
+		if !ok {
+			return nil, fmt.Errorf("ast: found %s, while expecting a statement", n.Kind)
+		}
+		statements = append(statements, stmt)
+	}
+
+	return statements, nil
+}
+
+// decodeExpressions decodes a list of expressions
+func decodeExpressions(list []*jsonNode) ([]Expression, error) {
+	expressions := []Expression{}
+	for _, n := range list {
+		if n == nil {
+			return nil, fmt.Errorf("ast: found null, while expecting an expression")
+		}
+
+		exp, err := decodeExpression(n)
+		if err != nil {
+			return nil, err
+		}
+		expressions = append(expressions, exp)
+	}
+
+	return expressions, nil
+}
+
+// decodePairs decodes the pairs of a hash literal
+func decodePairs(list []jsonPair) ([]HashPair, error) {
+	pairs := []HashPair{}
+	for _, n := range list {
+		if n.Key == nil || n.Value == nil {
+			return nil, fmt.Errorf("ast: found a pair without a key or a value")
+		}
+
+		key, err := decodeExpression(n.Key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := decodeExpression(n.Value)
+		if err != nil {
+			return nil, err
+		}
+		pairs = append(pairs, HashPair{Key: key, Value: value})
+	}
+
+	return pairs, nil
+}
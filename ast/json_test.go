@@ -0,0 +1,110 @@
+package ast
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/shavit/go-interpreter/token"
+)
+
+func TestJSONRoundTrip(t *testing.T) {
+	program := testProgram()
+	program.Statements = append(program.Statements,
+		&ReturnStatement{Token: token.Token{Type: token.RETURN, Literal: "return"}},
+		&LetStatement{
+			Token: token.Token{Type: token.LET, Literal: "let", Pos: token.Position{Filename: "main.mk", Offset: 40, Line: 3, Column: 1}},
+			Name:  ident("big"),
+			Value: integer(9007199254740993, "9007199254740993"),
+		},
+		&BadStatement{
+			Token: token.Token{Type: token.ASSIGN, Literal: "=", Pos: token.Position{Offset: 70, Line: 4, Column: 5}},
+			End:   token.Position{Offset: 73, Line: 4, Column: 8},
+		},
+		&ExpressionStatement{Expression: &BadExpression{Token: token.Token{Type: token.RPAREN, Literal: ")"}}},
+	)
+
+	data, err := MarshalJSON(program)
+	if err != nil {
+		t.Fatalf("Found error %v", err)
+	}
+
+	node, err := UnmarshalJSON(data)
+	if err != nil {
+		t.Fatalf("Found error %v", err)
+	}
+
+	if node.String() != program.String() {
+		t.Errorf("Found %q, while expecting %q", node.String(), program.String())
+	}
+
+	if !reflect.DeepEqual(node, program) {
+		t.Errorf("Found %#v, while expecting %#v", node, program)
+	}
+}
+
+func TestJSONEncoding(t *testing.T) {
+	stmt := &LetStatement{
+		Token: token.Token{Type: token.LET, Literal: "let", Pos: token.Position{Offset: 0, Line: 1, Column: 1}},
+		Name:  ident("x"),
+		Value: &PrefixExpression{Token: token.Token{Type: token.MINUS, Literal: "-"}, Operator: "-", Right: integer(1, "1")},
+	}
+
+	data, err := json.Marshal(&Program{Statements: []Statement{stmt}})
+	if err != nil {
+		t.Fatalf("Found error %v", err)
+	}
+
+	expected := `{"kind":"Program","statements":[{"kind":"LetStatement","token":{"type":"LET","literal":"let","pos":{"offset":0,"line":1,"column":1}},` +
+		`"name":{"kind":"Identifier","token":{"type":"IDENT","literal":"x","pos":{"offset":0,"line":0,"column":0}},"value":"x"},` +
+		`"letValue":{"kind":"PrefixExpression","token":{"type":"-","literal":"-","pos":{"offset":0,"line":0,"column":0}},"operator":"-",` +
+		`"right":{"kind":"IntegerLiteral","token":{"type":"INT","literal":"1","pos":{"offset":0,"line":0,"column":0}},"value":1}}}]}`
+
+	if string(data) != expected {
+		t.Errorf("Found %s, while expecting %s", data, expected)
+	}
+
+	var program Program
+	if err := json.Unmarshal(data, &program); err != nil {
+		t.Fatalf("Found error %v", err)
+	}
+
+	if program.String() != "let x = (-1);" {
+		t.Errorf("Found %q, while expecting %q", program.String(), "let x = (-1);")
+	}
+}
+
+func TestJSONErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"kind":"Unknown"}`, `unknown node kind "Unknown"`},
+		{`{"kind":"Program","statements":[{"kind":"Identifier","value":"x"}]}`, "expecting a statement"},
+		{`{"kind":"PrefixExpression","right":{"kind":"ReturnStatement"}}`, "expecting an expression"},
+		{`{"kind":"IntegerLiteral"}`, "has no value"},
+		{`{"kind":"IntegerLiteral","value":"x"}`, "cannot unmarshal"},
+		{`{"kind":"Program","statements":[null]}`, "found null, while expecting a statement"},
+		{`{"kind":"LetStatement"}`, "LetStatement has no name"},
+		{`{"kind":"PrefixExpression","operator":"-"}`, "PrefixExpression has no right"},
+		{`{"kind":"InfixExpression","operator":"+"}`, "InfixExpression has no left"},
+		{`{"kind":"InfixExpression","operator":"+","left":{"kind":"IntegerLiteral","value":1}}`, "InfixExpression has no right"},
+		{`{"kind":"LogicalExpression","operator":"&&","right":{"kind":"IntegerLiteral","value":1}}`, "LogicalExpression has no left"},
+		{`{"kind":"IfExpression","condition":{"kind":"Identifier","value":"x"}}`, "IfExpression has no consequence"},
+		{`{"kind":"IfExpression","consequence":{"kind":"BlockStatement"}}`, "IfExpression has no condition"},
+		{`{"kind":"FunctionLiteral","parameters":[]}`, "FunctionLiteral has no body"},
+		{`{"kind":"FunctionLiteral","parameters":[null],"body":{"kind":"BlockStatement"}}`, "FunctionLiteral has no parameter"},
+		{`{"kind":"CallExpression","arguments":[]}`, "CallExpression has no function"},
+		{`{"kind":"ArrayLiteral","elements":[null]}`, "found null, while expecting an expression"},
+		{`{"kind":"HashLiteral","pairs":[{"key":{"kind":"IntegerLiteral","value":1}}]}`, "without a key or a value"},
+		{`{"kind":"IndexExpression","left":{"kind":"Identifier","value":"x"}}`, "IndexExpression has no index"},
+	}
+
+	for _, tt := range tests {
+		_, err := UnmarshalJSON([]byte(tt.input))
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("Found %v, while expecting an error with %q", err, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package ast
+
+import (
+	"fmt"
+)
+
+// ModifierFunc returns the replacement of a node, or the node itself to
+//  keep it
+type ModifierFunc func(Node) Node
+
+// Modify walks the tree bottom-up: the children of a node are
+//  modified first, then the node itself is passed to the modifier
+// The tree is mutated, not copied: the child fields of every node are
+//  set to the replacements, so nodes the modifier keeps also keep their
+//  tokens and positions, and the original tree is no longer available
+// It panics when a replacement does not fit its slot, for example a
+//  statement in place of an expression
+func Modify(node Node, modifier ModifierFunc) Node {
+	switch n := node.(type) {
+	case nil:
+		return nil
+
+	// Statements
+	case *Program:
+		modifyStatements(n.Statements, modifier)
+	case *LetStatement:
+		n.Name = modifyIdentifier(n.Name, modifier)
+		n.Value = modifyExpression(n.Value, modifier)
+	case *ReturnStatement:
+		n.ReturnValue = modifyExpression(n.ReturnValue, modifier)
+	case *ExpressionStatement:
+		n.Expression = modifyExpression(n.Expression, modifier)
+	case *BlockStatement:
+		modifyStatements(n.Statements, modifier)
+	case *BadStatement:
+		// Leaf
+
+	// Expressions
+	case *Identifier, *IntegerLiteral, *FloatLiteral, *StringLiteral, *BooleanLiteral, *BadExpression:
+		// Leaves
+	case *PrefixExpression:
+		n.Right = modifyExpression(n.Right, modifier)
+	case *InfixExpression:
+		n.Left = modifyExpression(n.Left, modifier)
+		n.Right = modifyExpression(n.Right, modifier)
+	case *LogicalExpression:
+		n.Left = modifyExpression(n.Left, modifier)
+		n.Right = modifyExpression(n.Right, modifier)
+	case *IfExpression:
+		n.Condition = modifyExpression(n.Condition, modifier)
+		n.Consequence = modifyBlock(n.Consequence, modifier)
+		n.Alternative = modifyBlock(n.Alternative, modifier)
+	case *FunctionLiteral:
+		for i, p := range n.Parameters {
+			n.Parameters[i] = modifyIdentifier(p, modifier)
+		}
+		n.Body = modifyBlock(n.Body, modifier)
+	case *CallExpression:
+		n.Function = modifyExpression(n.Function, modifier)
+		modifyExpressions(n.Arguments, modifier)
+
+	case *ArrayLiteral:
+		modifyExpressions(n.Elements, modifier)
+
+	case *HashLiteral:
+		for i := range n.Pairs {
+			n.Pairs[i].Key = modifyExpression(n.Pairs[i].Key, modifier)
+			n.Pairs[i].Value = modifyExpression(n.Pairs[i].Value, modifier)
+		}
+
+	case *IndexExpression:
+		n.Left = modifyExpression(n.Left, modifier)
+		n.Index = modifyExpression(n.Index, modifier)
+
+	default:
+		panic(fmt.Sprintf("ast.Modify: unexpected node type %T", n))
+	}
+
+	return modifier(node)
+}
+
+// modifyStatements replaces the statements of a list in place
+func modifyStatements(list []Statement, modifier ModifierFunc) {
+	for i, s := range list {
+		if s == nil {
+			continue
+		}
+
+		modified := Modify(s, modifier)
+		stmt, ok := modified.(Statement)
+		if !ok {
+			panic(fmt.Sprintf("ast.Modify: %T cannot replace a statement", modified))
+		}
+		list[i] = stmt
+	}
+}
+
+// modifyExpressions replaces the expressions of a list in place
+func modifyExpressions(list []Expression, modifier ModifierFunc) {
+	for i, e := range list {
+		list[i] = modifyExpression(e, modifier)
+	}
+}
+
+// modifyExpression returns the replacement of an optional expression
+func modifyExpression(e Expression, modifier ModifierFunc) Expression {
+	if e == nil {
+		return nil
+	}
+
+	modified := Modify(e, modifier)
+	exp, ok := modified.(Expression)
+	if !ok {
+		panic(fmt.Sprintf("ast.Modify: %T cannot replace an expression", modified))
+	}
+
+	return exp
+}
+
+// modifyIdentifier returns the replacement of a name, which must be
+//  an identifier as well
+func modifyIdentifier(i *Identifier, modifier ModifierFunc) *Identifier {
+	if i == nil {
+		return nil
+	}
+
+	modified := Modify(i, modifier)
+	ident, ok := modified.(*Identifier)
+	if !ok {
+		panic(fmt.Sprintf("ast.Modify: %T cannot replace an identifier", modified))
+	}
+
+	return ident
+}
+
+// modifyBlock returns the replacement of a block, which must be a
+//  block as well
+func modifyBlock(b *BlockStatement, modifier ModifierFunc) *BlockStatement {
+	if b == nil {
+		return nil
+	}
+
+	modified := Modify(b, modifier)
+	block, ok := modified.(*BlockStatement)
+	if !ok {
+		panic(fmt.Sprintf("ast.Modify: %T cannot replace a block", modified))
+	}
+
+	return block
+}
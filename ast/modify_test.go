@@ -0,0 +1,148 @@
+package ast
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/shavit/go-interpreter/token"
+)
+
+func TestModify(t *testing.T) {
+	one := func() Expression { return integer(1, "1") }
+	two := func() Expression { return integer(2, "2") }
+
+	// Replace every 1 with 2
+	turnOneIntoTwo := func(node Node) Node {
+		integer, ok := node.(*IntegerLiteral)
+		if !ok || integer.Value != 1 {
+			return node
+		}
+
+		return &IntegerLiteral{Token: token.Token{Type: token.INT, Literal: "2"}, Value: 2}
+	}
+
+	tests := []struct {
+		input    Node
+		expected Node
+	}{
+		{one(), two()},
+		{
+			&Program{Statements: []Statement{&ExpressionStatement{Expression: one()}}},
+			&Program{Statements: []Statement{&ExpressionStatement{Expression: two()}}},
+		},
+		{
+			&InfixExpression{Left: one(), Operator: "+", Right: two()},
+			&InfixExpression{Left: two(), Operator: "+", Right: two()},
+		},
+		{
+			&PrefixExpression{Operator: "-", Right: one()},
+			&PrefixExpression{Operator: "-", Right: two()},
+		},
+		{
+			&IfExpression{
+				Condition:   one(),
+				Consequence: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: one()}}},
+				Alternative: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: one()}}},
+			},
+			&IfExpression{
+				Condition:   two(),
+				Consequence: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: two()}}},
+				Alternative: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: two()}}},
+			},
+		},
+		{&ReturnStatement{ReturnValue: one()}, &ReturnStatement{ReturnValue: two()}},
+		{&LetStatement{Name: ident("x"), Value: one()}, &LetStatement{Name: ident("x"), Value: two()}},
+		{
+			&FunctionLiteral{
+				Parameters: []*Identifier{ident("x")},
+				Body:       &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: one()}}},
+			},
+			&FunctionLiteral{
+				Parameters: []*Identifier{ident("x")},
+				Body:       &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: two()}}},
+			},
+		},
+		{
+			&CallExpression{Function: ident("f"), Arguments: []Expression{one(), two()}},
+			&CallExpression{Function: ident("f"), Arguments: []Expression{two(), two()}},
+		},
+		{
+			&IndexExpression{Left: &ArrayLiteral{Elements: []Expression{one(), two()}}, Index: one()},
+			&IndexExpression{Left: &ArrayLiteral{Elements: []Expression{two(), two()}}, Index: two()},
+		},
+		{
+			&LogicalExpression{Left: one(), Operator: "&&", Right: one()},
+			&LogicalExpression{Left: two(), Operator: "&&", Right: two()},
+		},
+		{
+			&HashLiteral{Pairs: []HashPair{{Key: one(), Value: one()}, {Key: two(), Value: one()}}},
+			&HashLiteral{Pairs: []HashPair{{Key: two(), Value: two()}, {Key: two(), Value: two()}}},
+		},
+	}
+
+	for _, tt := range tests {
+		modified := Modify(tt.input, turnOneIntoTwo)
+
+		if !reflect.DeepEqual(modified, tt.expected) {
+			t.Errorf("Found %#v, while expecting %#v", modified, tt.expected)
+		}
+	}
+}
+
+func TestModifyKeepsUntouchedNodes(t *testing.T) {
+	program := testProgram()
+	let := program.Statements[0].(*LetStatement)
+	name := let.Name
+
+	// Rename x to z, and keep everything else
+	modified := Modify(program, func(node Node) Node {
+		if i, ok := node.(*Identifier); ok && i.Value == "x" {
+			return &Identifier{Token: i.Token, Value: "z"}
+		}
+		return node
+	})
+
+	if modified != program || program.Statements[0] != let || let.Name != name {
+		t.Errorf("Found new nodes, while expecting the untouched nodes to be kept")
+	}
+
+	expected := "let add = fn(z, y) { return (z + y); };if(!ok) { add(1, \"a\") } else { false }"
+	if program.String() != expected {
+		t.Errorf("Found %q, while expecting %q", program.String(), expected)
+	}
+}
+
+func TestModifyMutatesTheTree(t *testing.T) {
+	infix := &InfixExpression{Operator: "+", Left: integer(1, "1"), Right: integer(2, "2")}
+	original := infix.Left
+
+	modified := Modify(infix, func(node Node) Node {
+		if i, ok := node.(*IntegerLiteral); ok && i.Value == 1 {
+			return integer(3, "3")
+		}
+		return node
+	})
+
+	if modified != infix || infix.Left == original {
+		t.Errorf("Found a copy, while expecting the tree to be mutated")
+	}
+
+	if infix.String() != "(3 + 2)" || original.String() != "1" {
+		t.Errorf("Found %q and %q, while expecting \"(3 + 2)\" and \"1\"", infix.String(), original.String())
+	}
+}
+
+func TestModifyInvalidReplacement(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Found no panic, while expecting a panic for a statement in an expression slot")
+		}
+	}()
+
+	Modify(&PrefixExpression{Operator: "-", Right: integer(1, "1")}, func(node Node) Node {
+		if _, ok := node.(*IntegerLiteral); ok {
+			return &ReturnStatement{}
+		}
+		return node
+	})
+}
@@ -0,0 +1,151 @@
+package ast
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/shavit/go-interpreter/token"
+)
+
+func ident(name string) *Identifier {
+	return &Identifier{Token: token.Token{Type: token.IDENT, Literal: name}, Value: name}
+}
+
+func integer(value int64, literal string) *IntegerLiteral {
+	return &IntegerLiteral{Token: token.Token{Type: token.INT, Literal: literal}, Value: value}
+}
+
+// let add = fn(x, y) { return x + y; }; if (!ok) { add(1, "a") } else { false }
+func testProgram() *Program {
+	return &Program{
+		Statements: []Statement{
+			&LetStatement{
+				Token: token.Token{Type: token.LET, Literal: "let"},
+				Name:  ident("add"),
+				Value: &FunctionLiteral{
+					Token:      token.Token{Type: token.FUNCTION, Literal: "fn"},
+					Parameters: []*Identifier{ident("x"), ident("y")},
+					Body: &BlockStatement{
+						Token: token.Token{Type: token.LBRACE, Literal: "{"},
+						Statements: []Statement{
+							&ReturnStatement{
+								Token: token.Token{Type: token.RETURN, Literal: "return"},
+								ReturnValue: &InfixExpression{
+									Token:    token.Token{Type: token.PLUS, Literal: "+"},
+									Left:     ident("x"),
+									Operator: "+",
+									Right:    ident("y"),
+								},
+							},
+						},
+					},
+				},
+			},
+			&ExpressionStatement{
+				Token: token.Token{Type: token.IF, Literal: "if"},
+				Expression: &IfExpression{
+					Token: token.Token{Type: token.IF, Literal: "if"},
+					Condition: &PrefixExpression{
+						Token:    token.Token{Type: token.BANG, Literal: "!"},
+						Operator: "!",
+						Right:    ident("ok"),
+					},
+					Consequence: &BlockStatement{
+						Token: token.Token{Type: token.LBRACE, Literal: "{"},
+						Statements: []Statement{
+							&ExpressionStatement{
+								Token: token.Token{Type: token.IDENT, Literal: "add"},
+								Expression: &CallExpression{
+									Token:    token.Token{Type: token.LPAREN, Literal: "("},
+									Function: ident("add"),
+									Arguments: []Expression{
+										integer(1, "1"),
+										&StringLiteral{Token: token.Token{Type: token.STRING, Literal: `"a"`}, Value: "a"},
+									},
+								},
+							},
+						},
+					},
+					Alternative: &BlockStatement{
+						Token: token.Token{Type: token.LBRACE, Literal: "{"},
+						Statements: []Statement{
+							&ExpressionStatement{
+								Token:      token.Token{Type: token.FALSE, Literal: "false"},
+								Expression: &BooleanLiteral{Token: token.Token{Type: token.FALSE, Literal: "false"}, Value: false},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestInspect(t *testing.T) {
+	var visited []string
+	Inspect(testProgram(), func(n Node) bool {
+		if n != nil {
+			visited = append(visited, reflect.TypeOf(n).Elem().Name())
+		}
+		return true
+	})
+
+	expected := []string{
+		"Program",
+		"LetStatement", "Identifier", "FunctionLiteral", "Identifier", "Identifier",
+		"BlockStatement", "ReturnStatement", "InfixExpression", "Identifier", "Identifier",
+		"ExpressionStatement", "IfExpression", "PrefixExpression", "Identifier",
+		"BlockStatement", "ExpressionStatement", "CallExpression", "Identifier", "IntegerLiteral", "StringLiteral",
+		"BlockStatement", "ExpressionStatement", "BooleanLiteral",
+	}
+
+	if !reflect.DeepEqual(visited, expected) {
+		t.Errorf("Found %v, while expecting %v", visited, expected)
+	}
+}
+
+func TestInspectSkipsChildren(t *testing.T) {
+	var identifiers []string
+	Inspect(testProgram(), func(n Node) bool {
+		// Skip the function bodies
+		if _, ok := n.(*FunctionLiteral); ok {
+			return false
+		}
+		if i, ok := n.(*Identifier); ok {
+			identifiers = append(identifiers, i.Value)
+		}
+		return true
+	})
+
+	expected := []string{"add", "ok", "add"}
+	if !reflect.DeepEqual(identifiers, expected) {
+		t.Errorf("Found %v, while expecting %v", identifiers, expected)
+	}
+}
+
+// depthVisitor records the depth of every node, and returns to the
+//  parent depth on nil
+type depthVisitor struct {
+	depth  int
+	depths *[]int
+}
+
+func (v depthVisitor) Visit(n Node) Visitor {
+	if n == nil {
+		return nil
+	}
+	*v.depths = append(*v.depths, v.depth)
+
+	return depthVisitor{depth: v.depth + 1, depths: v.depths}
+}
+
+func TestWalk(t *testing.T) {
+	var depths []int
+	Walk(depthVisitor{depths: &depths}, testProgram().Statements[0])
+
+	// let, add, fn, x, y, block, return, +, x, y
+	expected := []int{0, 1, 1, 2, 2, 2, 3, 4, 5, 5}
+	if !reflect.DeepEqual(depths, expected) {
+		t.Errorf("Found %v, while expecting %v", depths, expected)
+	}
+}
@@ -0,0 +1,259 @@
+// Package code defines the instructions of the bytecode virtual machine
+//
+// An instruction is a one byte opcode, followed by its operands in big
+//  endian order. The width of every operand is set by the definition of
+//  the opcode
+package code
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// Instructions is a sequence of encoded instructions
+type Instructions []byte
+
+// Opcode is the first byte of an instruction
+type Opcode byte
+
+const (
+	// OpConstant pushes the constant at an index of the constant pool
+	OpConstant Opcode = iota
+
+	// OpPop removes the value at the top of the stack
+	OpPop
+
+	// Infix operators pop two values, and push the result
+	OpAdd
+	OpSub
+	OpMul
+	OpDiv
+	OpEqual
+	OpNotEqual
+	OpGreaterThan
+	OpLessThan
+
+	// Prefix operators replace the value at the top of the stack
+	OpMinus
+	OpBang
+
+	OpTrue
+	OpFalse
+	OpNull
+
+	// OpJumpNotTruthy pops the condition, and jumps to an offset when it
+	//  is false or null
+	OpJumpNotTruthy
+	OpJump
+
+	OpGetGlobal
+	OpSetGlobal
+	OpGetLocal
+	OpSetLocal
+
+	// OpGetFree pushes a free variable of the current closure
+	OpGetFree
+
+	// OpCurrentClosure pushes the closure that is running, so functions
+	//  can call themselves
+	OpCurrentClosure
+
+	// OpClosure pushes a closure of the function constant at an index,
+	//  with a number of free variables from the stack
+	OpClosure
+
+	// OpCall calls the function below a number of arguments
+	OpCall
+
+	// OpReturnValue returns the value at the top of the stack, and
+	//  OpReturn returns null
+	OpReturnValue
+	OpReturn
+
+	// OpArray replaces a number of values at the top of the stack with
+	//  an array of them
+	OpArray
+
+	// OpHash replaces a number of keys and values at the top of the
+	//  stack with a hash of them
+	OpHash
+
+	// OpIndex pops an index and an array or a hash, and pushes the
+	//  element
+	OpIndex
+)
+
+// Definition is the name of an opcode, and the width of its operands in
+//  bytes
+type Definition struct {
+	Name          string
+	OperandWidths []int
+}
+
+var definitions = map[Opcode]*Definition{
+	OpConstant:       {"OpConstant", []int{2}},
+	OpPop:            {"OpPop", []int{}},
+	OpAdd:            {"OpAdd", []int{}},
+	OpSub:            {"OpSub", []int{}},
+	OpMul:            {"OpMul", []int{}},
+	OpDiv:            {"OpDiv", []int{}},
+	OpEqual:          {"OpEqual", []int{}},
+	OpNotEqual:       {"OpNotEqual", []int{}},
+	OpGreaterThan:    {"OpGreaterThan", []int{}},
+	OpLessThan:       {"OpLessThan", []int{}},
+	OpMinus:          {"OpMinus", []int{}},
+	OpBang:           {"OpBang", []int{}},
+	OpTrue:           {"OpTrue", []int{}},
+	OpFalse:          {"OpFalse", []int{}},
+	OpNull:           {"OpNull", []int{}},
+	OpJumpNotTruthy:  {"OpJumpNotTruthy", []int{2}},
+	OpJump:           {"OpJump", []int{2}},
+	OpGetGlobal:      {"OpGetGlobal", []int{2}},
+	OpSetGlobal:      {"OpSetGlobal", []int{2}},
+	OpGetLocal:       {"OpGetLocal", []int{1}},
+	OpSetLocal:       {"OpSetLocal", []int{1}},
+	OpGetFree:        {"OpGetFree", []int{1}},
+	OpCurrentClosure: {"OpCurrentClosure", []int{}},
+	OpClosure:        {"OpClosure", []int{2, 1}},
+	OpCall:           {"OpCall", []int{1}},
+	OpReturnValue:    {"OpReturnValue", []int{}},
+	OpReturn:         {"OpReturn", []int{}},
+	OpArray:          {"OpArray", []int{2}},
+	OpHash:           {"OpHash", []int{2}},
+	OpIndex:          {"OpIndex", []int{}},
+}
+
+// Lookup returns the definition of an opcode
+func Lookup(op byte) (*Definition, error) {
+	def, ok := definitions[Opcode(op)]
+	if !ok {
+		return nil, fmt.Errorf("Opcode %d undefined", op)
+	}
+
+	return def, nil
+}
+
+// CheckOperands checks that the operands of an instruction fit in the
+//  widths of its definition
+// Make cuts operands that do not fit, so they must be checked first
+func CheckOperands(op Opcode, operands ...int) error {
+	def, ok := definitions[op]
+	if !ok {
+		return fmt.Errorf("Opcode %d undefined", op)
+	}
+
+	if len(operands) != len(def.OperandWidths) {
+		return fmt.Errorf("Found %d operands for %s, while expecting %d", len(operands), def.Name, len(def.OperandWidths))
+	}
+
+	for i, width := range def.OperandWidths {
+		limit := 1<<(8*width) - 1
+		if operands[i] < 0 || operands[i] > limit {
+			return fmt.Errorf("Operand %d of %s is out of range, the limit is %d", operands[i], def.Name, limit)
+		}
+	}
+
+	return nil
+}
+
+// Make encodes an instruction
+// It returns an empty instruction for unknown opcodes
+func Make(op Opcode, operands ...int) []byte {
+	def, ok := definitions[op]
+	if !ok {
+		return []byte{}
+	}
+
+	length := 1
+	for _, w := range def.OperandWidths {
+		length += w
+	}
+
+	ins := make([]byte, length)
+	ins[0] = byte(op)
+
+	offset := 1
+	for i, o := range operands {
+		width := def.OperandWidths[i]
+		switch width {
+		case 2:
+			binary.BigEndian.PutUint16(ins[offset:], uint16(o))
+		case 1:
+			ins[offset] = byte(o)
+		}
+		offset += width
+	}
+
+	return ins
+}
+
+// ReadOperands decodes the operands of an instruction, after its opcode
+// It returns the operands and the number of bytes they take
+func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
+	operands := make([]int, len(def.OperandWidths))
+	offset := 0
+
+	for i, width := range def.OperandWidths {
+		switch width {
+		case 2:
+			operands[i] = int(ReadUint16(ins[offset:]))
+		case 1:
+			operands[i] = int(ReadUint8(ins[offset:]))
+		}
+		offset += width
+	}
+
+	return operands, offset
+}
+
+// ReadUint16 decodes a two bytes operand
+func ReadUint16(ins Instructions) uint16 {
+	return binary.BigEndian.Uint16(ins)
+}
+
+// ReadUint8 decodes a one byte operand
+func ReadUint8(ins Instructions) uint8 {
+	return uint8(ins[0])
+}
+
+// String disassembles the instructions, one per line with its offset
+func (ins Instructions) String() string {
+	var out bytes.Buffer
+
+	i := 0
+	for i < len(ins) {
+		def, err := Lookup(ins[i])
+		if err != nil {
+			fmt.Fprintf(&out, "Error: %s\n", err)
+			i += 1
+			continue
+		}
+
+		operands, read := ReadOperands(def, ins[i+1:])
+		fmt.Fprintf(&out, "%04d %s\n", i, ins.fmtInstruction(def, operands))
+
+		i += 1 + read
+	}
+
+	return out.String()
+}
+
+// fmtInstruction formats the name of an opcode with its operands
+func (ins Instructions) fmtInstruction(def *Definition, operands []int) string {
+	count := len(def.OperandWidths)
+	if len(operands) != count {
+		return fmt.Sprintf("Error: operand length %d does not match defined %d", len(operands), count)
+	}
+
+	switch count {
+	case 0:
+		return def.Name
+	case 1:
+		return fmt.Sprintf("%s %d", def.Name, operands[0])
+	case 2:
+		return fmt.Sprintf("%s %d %d", def.Name, operands[0], operands[1])
+	}
+
+	return fmt.Sprintf("Error: unhandled operand count for %s", def.Name)
+}
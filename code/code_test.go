@@ -0,0 +1,112 @@
+package code
+
+import (
+	"testing"
+)
+
+func TestMake(t *testing.T) {
+	tests := []struct {
+		op       Opcode
+		operands []int
+		expected []byte
+	}{
+		{OpConstant, []int{65534}, []byte{byte(OpConstant), 255, 254}},
+		{OpAdd, []int{}, []byte{byte(OpAdd)}},
+		{OpGetLocal, []int{255}, []byte{byte(OpGetLocal), 255}},
+		{OpClosure, []int{65534, 255}, []byte{byte(OpClosure), 255, 254, 255}},
+	}
+
+	for _, tt := range tests {
+		instruction := Make(tt.op, tt.operands...)
+
+		if string(instruction) != string(tt.expected) {
+			t.Errorf("Found %v, while expecting %v", instruction, tt.expected)
+		}
+	}
+}
+
+func TestInstructionsString(t *testing.T) {
+	instructions := []Instructions{
+		Make(OpAdd),
+		Make(OpGetLocal, 1),
+		Make(OpConstant, 2),
+		Make(OpConstant, 65535),
+		Make(OpClosure, 65535, 255),
+	}
+
+	expected := `0000 OpAdd
+0001 OpGetLocal 1
+0003 OpConstant 2
+0006 OpConstant 65535
+0009 OpClosure 65535 255
+`
+
+	concatted := Instructions{}
+	for _, ins := range instructions {
+		concatted = append(concatted, ins...)
+	}
+
+	if concatted.String() != expected {
+		t.Errorf("Found %q, while expecting %q", concatted.String(), expected)
+	}
+}
+
+func TestReadOperands(t *testing.T) {
+	tests := []struct {
+		op        Opcode
+		operands  []int
+		bytesRead int
+	}{
+		{OpConstant, []int{65535}, 2},
+		{OpGetLocal, []int{255}, 1},
+		{OpClosure, []int{65535, 255}, 3},
+	}
+
+	for _, tt := range tests {
+		instruction := Make(tt.op, tt.operands...)
+
+		def, err := Lookup(byte(tt.op))
+		if err != nil {
+			t.Fatalf("Found error %v", err)
+		}
+
+		operands, n := ReadOperands(def, instruction[1:])
+		if n != tt.bytesRead {
+			t.Fatalf("Found %d bytes read, while expecting %d", n, tt.bytesRead)
+		}
+
+		for i, want := range tt.operands {
+			if operands[i] != want {
+				t.Errorf("Found operand %d, while expecting %d", operands[i], want)
+			}
+		}
+	}
+}
+
+func TestCheckOperands(t *testing.T) {
+	tests := []struct {
+		op       Opcode
+		operands []int
+		expected string
+	}{
+		{OpConstant, []int{65535}, ""},
+		{OpConstant, []int{65536}, "Operand 65536 of OpConstant is out of range, the limit is 65535"},
+		{OpGetLocal, []int{255}, ""},
+		{OpGetLocal, []int{256}, "Operand 256 of OpGetLocal is out of range, the limit is 255"},
+		{OpClosure, []int{1, 256}, "Operand 256 of OpClosure is out of range, the limit is 255"},
+		{OpJump, []int{-1}, "Operand -1 of OpJump is out of range, the limit is 65535"},
+		{OpCall, []int{}, "Found 0 operands for OpCall, while expecting 1"},
+		{Opcode(255), []int{}, "Opcode 255 undefined"},
+	}
+
+	for _, tt := range tests {
+		err := CheckOperands(tt.op, tt.operands...)
+
+		if tt.expected == "" && err != nil {
+			t.Errorf("Found error %v, while expecting none", err)
+		}
+		if tt.expected != "" && (err == nil || err.Error() != tt.expected) {
+			t.Errorf("Found error %v, while expecting %q", err, tt.expected)
+		}
+	}
+}
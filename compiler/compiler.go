@@ -0,0 +1,535 @@
+// Package compiler lowers a syntax tree to the bytecode of the virtual
+//  machine
+//
+// Names are resolved when they are compiled. A name that is not defined
+//  yet is a global, that a later let statement sets, so functions use
+//  the globals like in the evaluator. The locals of outer functions are
+//  different:
+//
+//   - A closure copies the locals it uses when it is created, so it does
+//     not see them bound again later, and
+//     `fn() { let x = 1; let f = fn() { x }; let x = 2; f() }()` is 1
+//   - A function cannot use the locals of an outer function that are
+//     defined after it, so
+//     `fn() { let g = fn() { h() }; let h = fn() { 1 }; g() }()` is the
+//     error "Identifier not found: h"
+//
+// The evaluator returns 2 and 1 for these programs
+package compiler
+
+import (
+	"fmt"
+
+	"github.com/shavit/go-interpreter/ast"
+	"github.com/shavit/go-interpreter/code"
+	"github.com/shavit/go-interpreter/object"
+)
+
+// Bytecode is the compiled program, and the constants its instructions
+//  refer to
+type Bytecode struct {
+	Instructions code.Instructions
+	Constants    []object.Object
+
+	// The names of the globals, by slot
+	GlobalNames []string
+}
+
+// emittedInstruction is the opcode of an instruction and its offset
+type emittedInstruction struct {
+	Opcode   code.Opcode
+	Position int
+}
+
+// compilationScope holds the instructions of the program, or of the
+//  function that is compiled
+type compilationScope struct {
+	instructions code.Instructions
+
+	// The last two instructions, so the compiler can remove or replace
+	//  the pop of the last expression
+	lastInstruction     emittedInstruction
+	previousInstruction emittedInstruction
+}
+
+// Compiler compiles a program to bytecode
+type Compiler struct {
+	constants   []object.Object
+	symbolTable *SymbolTable
+
+	scopes     []compilationScope
+	scopeIndex int
+
+	// The first operand that did not fit in its instruction
+	err error
+}
+
+// New creates a compiler
+func New() *Compiler {
+	return &Compiler{
+		symbolTable: NewSymbolTable(),
+		scopes:      []compilationScope{{}},
+	}
+}
+
+// Compile compiles a node, and the nodes inside it
+// Programs that need operands larger than the instructions can hold,
+//  like too many constants or locals, are compile errors
+func (c *Compiler) Compile(node ast.Node) error {
+	if err := c.compile(node); err != nil {
+		return err
+	}
+
+	return c.err
+}
+
+// compile compiles a node without checking the operands that were
+//  emitted
+func (c *Compiler) compile(node ast.Node) error {
+	switch node := node.(type) {
+	// Statements
+	case *ast.Program:
+		return c.compileProgram(node)
+	case *ast.ExpressionStatement:
+		if err := c.compile(node.Expression); err != nil {
+			return err
+		}
+		c.emit(code.OpPop)
+	case *ast.BlockStatement:
+		for _, s := range node.Statements {
+			if err := c.compile(s); err != nil {
+				return err
+			}
+		}
+	case *ast.LetStatement:
+		return c.compileLetStatement(node)
+	case *ast.ReturnStatement:
+		if err := c.compileOrNull(node.ReturnValue); err != nil {
+			return err
+		}
+		c.emit(code.OpReturnValue)
+	case *ast.BadStatement:
+		return fmt.Errorf("Syntax error at %s", node.Token.Pos)
+
+	// Expressions
+	case *ast.IntegerLiteral:
+		c.emit(code.OpConstant, c.addConstant(&object.Integer{Value: node.Value}))
+	case *ast.FloatLiteral:
+		c.emit(code.OpConstant, c.addConstant(&object.Float{Value: node.Value}))
+	case *ast.StringLiteral:
+		c.emit(code.OpConstant, c.addConstant(&object.String{Value: node.Value}))
+	case *ast.BooleanLiteral:
+		if node.Value {
+			c.emit(code.OpTrue)
+		} else {
+			c.emit(code.OpFalse)
+		}
+	case *ast.Identifier:
+		symbol, ok := c.symbolTable.Resolve(node.Value)
+		if !ok {
+			symbol = c.symbolTable.DefineLater(node.Value)
+		}
+		c.loadSymbol(symbol)
+	case *ast.PrefixExpression:
+		return c.compilePrefixExpression(node)
+	case *ast.InfixExpression:
+		return c.compileInfixExpression(node)
+	case *ast.LogicalExpression:
+		return c.compileLogicalExpression(node)
+	case *ast.IfExpression:
+		return c.compileIfExpression(node)
+	case *ast.FunctionLiteral:
+		return c.compileFunction(node, "")
+	case *ast.CallExpression:
+		if err := c.compile(node.Function); err != nil {
+			return err
+		}
+		for _, arg := range node.Arguments {
+			if err := c.compile(arg); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpCall, len(node.Arguments))
+	case *ast.ArrayLiteral:
+		for _, el := range node.Elements {
+			if err := c.compile(el); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpArray, len(node.Elements))
+	case *ast.HashLiteral:
+		for _, pair := range node.Pairs {
+			if err := c.compile(pair.Key); err != nil {
+				return err
+			}
+			if err := c.compile(pair.Value); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpHash, len(node.Pairs)*2)
+	case *ast.IndexExpression:
+		if err := c.compile(node.Left); err != nil {
+			return err
+		}
+		if err := c.compile(node.Index); err != nil {
+			return err
+		}
+		c.emit(code.OpIndex)
+	case *ast.BadExpression:
+		return fmt.Errorf("Syntax error at %s", node.Token.Pos)
+	}
+
+	return nil
+}
+
+// Bytecode returns the compiled program
+func (c *Compiler) Bytecode() *Bytecode {
+	return &Bytecode{
+		Instructions: c.currentInstructions(),
+		Constants:    c.constants,
+		GlobalNames:  c.symbolTable.names,
+	}
+}
+
+// compileProgram compiles the statements of the program
+// The value of a program is the value of its last statement, like in
+//  the evaluator, so a let statement at the end leaves null
+func (c *Compiler) compileProgram(program *ast.Program) error {
+	for _, s := range program.Statements {
+		if err := c.compile(s); err != nil {
+			return err
+		}
+	}
+
+	if len(program.Statements) > 0 && !c.lastInstructionIs(code.OpPop) {
+		c.emit(code.OpNull)
+		c.emit(code.OpPop)
+	}
+
+	return nil
+}
+
+// compileLetStatement binds the value to a symbol
+// The symbol is defined after the value, so values cannot refer to
+//  their own name, except functions that call themselves
+func (c *Compiler) compileLetStatement(node *ast.LetStatement) error {
+	var err error
+	if fn, ok := node.Value.(*ast.FunctionLiteral); ok {
+		err = c.compileFunction(fn, node.Name.Value)
+	} else {
+		err = c.compileOrNull(node.Value)
+	}
+	if err != nil {
+		return err
+	}
+
+	symbol := c.symbolTable.Define(node.Name.Value)
+	if symbol.Scope == GlobalScope {
+		c.emit(code.OpSetGlobal, symbol.Index)
+	} else {
+		c.emit(code.OpSetLocal, symbol.Index)
+	}
+
+	return nil
+}
+
+// compileOrNull compiles an optional expression
+// The parser leaves missing expressions as nil
+func (c *Compiler) compileOrNull(exp ast.Expression) error {
+	if exp == nil {
+		c.emit(code.OpNull)
+		return nil
+	}
+
+	return c.compile(exp)
+}
+
+// compilePrefixExpression compiles the operand, and the operator after it
+func (c *Compiler) compilePrefixExpression(node *ast.PrefixExpression) error {
+	if err := c.compile(node.Right); err != nil {
+		return err
+	}
+
+	switch node.Operator {
+	case "!":
+		c.emit(code.OpBang)
+	case "-":
+		c.emit(code.OpMinus)
+	default:
+		return fmt.Errorf("Unknown operator: %s", node.Operator)
+	}
+
+	return nil
+}
+
+// Opcodes of the infix operators
+var infixOpcodes = map[string]code.Opcode{
+	"+":  code.OpAdd,
+	"-":  code.OpSub,
+	"*":  code.OpMul,
+	"/":  code.OpDiv,
+	"==": code.OpEqual,
+	"!=": code.OpNotEqual,
+	">":  code.OpGreaterThan,
+	"<":  code.OpLessThan,
+}
+
+// compileInfixExpression compiles both operands from left to right, and
+//  the operator after them
+func (c *Compiler) compileInfixExpression(node *ast.InfixExpression) error {
+	if err := c.compile(node.Left); err != nil {
+		return err
+	}
+	if err := c.compile(node.Right); err != nil {
+		return err
+	}
+
+	op, ok := infixOpcodes[node.Operator]
+	if !ok {
+		return fmt.Errorf("Unknown operator: %s", node.Operator)
+	}
+	c.emit(op)
+
+	return nil
+}
+
+// compileLogicalExpression jumps to the result as soon as an operand
+//  decides it, so the right operand may not run
+// The operands of || are negated, so both operators jump when the
+//  operand is not truthy
+func (c *Compiler) compileLogicalExpression(node *ast.LogicalExpression) error {
+	negate := node.Operator == "||"
+	result, decided := code.OpTrue, code.OpFalse
+	if negate {
+		result, decided = code.OpFalse, code.OpTrue
+	}
+
+	var jumps []int
+	for _, operand := range []ast.Expression{node.Left, node.Right} {
+		if err := c.compile(operand); err != nil {
+			return err
+		}
+		if negate {
+			c.emit(code.OpBang)
+		}
+
+		// The offsets are set once the result is compiled
+		jumps = append(jumps, c.emit(code.OpJumpNotTruthy, 9999))
+	}
+
+	c.emit(result)
+	jumpPos := c.emit(code.OpJump, 9999)
+
+	for _, pos := range jumps {
+		c.changeOperand(pos, len(c.currentInstructions()))
+	}
+	c.emit(decided)
+
+	c.changeOperand(jumpPos, len(c.currentInstructions()))
+
+	return nil
+}
+
+// compileIfExpression jumps over the consequence when the condition is
+//  not truthy
+// Both branches leave a value on the stack, null for a missing
+//  alternative
+func (c *Compiler) compileIfExpression(node *ast.IfExpression) error {
+	if err := c.compile(node.Condition); err != nil {
+		return err
+	}
+
+	// The offsets are set once the branches are compiled
+	jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+	if err := c.compileBlockValue(node.Consequence); err != nil {
+		return err
+	}
+
+	jumpPos := c.emit(code.OpJump, 9999)
+	c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+
+	if node.Alternative == nil {
+		c.emit(code.OpNull)
+	} else if err := c.compileBlockValue(node.Alternative); err != nil {
+		return err
+	}
+
+	c.changeOperand(jumpPos, len(c.currentInstructions()))
+
+	return nil
+}
+
+// compileBlockValue compiles a block that leaves the value of its last
+//  expression on the stack, or null
+func (c *Compiler) compileBlockValue(block *ast.BlockStatement) error {
+	if err := c.compile(block); err != nil {
+		return err
+	}
+
+	if c.lastInstructionIs(code.OpPop) {
+		c.removeLastPop()
+	} else {
+		c.emit(code.OpNull)
+	}
+
+	return nil
+}
+
+// compileFunction compiles the body of a function in a new scope, and
+//  creates a closure of it
+// A named function can call itself through OpCurrentClosure, since its
+//  binding is set only after the closure is created
+func (c *Compiler) compileFunction(node *ast.FunctionLiteral, name string) error {
+	c.enterScope()
+
+	if name != "" {
+		c.symbolTable.DefineFunctionName(name)
+	}
+	for _, p := range node.Parameters {
+		c.symbolTable.DefineParameter(p.Value)
+	}
+
+	if err := c.compile(node.Body); err != nil {
+		return err
+	}
+
+	// The value of the last expression is returned
+	if c.lastInstructionIs(code.OpPop) {
+		c.replaceLastPopWithReturn()
+	}
+	if !c.lastInstructionIs(code.OpReturnValue) {
+		c.emit(code.OpReturn)
+	}
+
+	freeSymbols := c.symbolTable.FreeSymbols
+	numLocals := c.symbolTable.numDefinitions
+	localNames := c.symbolTable.names
+	instructions := c.leaveScope()
+
+	// The closure captures the free variables from the stack
+	for _, s := range freeSymbols {
+		c.loadSymbol(s)
+	}
+
+	fn := &object.CompiledFunction{
+		Instructions:  instructions,
+		NumLocals:     numLocals,
+		NumParameters: len(node.Parameters),
+		LocalNames:    localNames,
+		Literal:       node,
+	}
+	c.emit(code.OpClosure, c.addConstant(fn), len(freeSymbols))
+
+	return nil
+}
+
+// loadSymbol pushes the value of a symbol from its scope
+func (c *Compiler) loadSymbol(s Symbol) {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(code.OpGetGlobal, s.Index)
+	case LocalScope:
+		c.emit(code.OpGetLocal, s.Index)
+	case FreeScope:
+		c.emit(code.OpGetFree, s.Index)
+	case FunctionScope:
+		c.emit(code.OpCurrentClosure)
+	}
+}
+
+// addConstant adds a constant to the pool, and returns its index
+func (c *Compiler) addConstant(obj object.Object) int {
+	c.constants = append(c.constants, obj)
+	return len(c.constants) - 1
+}
+
+// emit adds an instruction to the current scope, and returns its offset
+func (c *Compiler) emit(op code.Opcode, operands ...int) int {
+	c.checkOperands(op, operands...)
+	ins := code.Make(op, operands...)
+	pos := c.addInstruction(ins)
+
+	scope := &c.scopes[c.scopeIndex]
+	scope.previousInstruction = scope.lastInstruction
+	scope.lastInstruction = emittedInstruction{Opcode: op, Position: pos}
+
+	return pos
+}
+
+func (c *Compiler) addInstruction(ins []byte) int {
+	pos := len(c.currentInstructions())
+	c.scopes[c.scopeIndex].instructions = append(c.currentInstructions(), ins...)
+
+	return pos
+}
+
+func (c *Compiler) currentInstructions() code.Instructions {
+	return c.scopes[c.scopeIndex].instructions
+}
+
+// lastInstructionIs checks the opcode of the last instruction of the
+//  current scope
+func (c *Compiler) lastInstructionIs(op code.Opcode) bool {
+	if len(c.currentInstructions()) == 0 {
+		return false
+	}
+
+	return c.scopes[c.scopeIndex].lastInstruction.Opcode == op
+}
+
+// removeLastPop removes the last instruction, that is a pop
+func (c *Compiler) removeLastPop() {
+	scope := &c.scopes[c.scopeIndex]
+
+	scope.instructions = scope.instructions[:scope.lastInstruction.Position]
+	scope.lastInstruction = scope.previousInstruction
+}
+
+// replaceLastPopWithReturn returns the value that the last instruction
+//  pops
+func (c *Compiler) replaceLastPopWithReturn() {
+	pos := c.scopes[c.scopeIndex].lastInstruction.Position
+	c.replaceInstruction(pos, code.Make(code.OpReturnValue))
+
+	c.scopes[c.scopeIndex].lastInstruction.Opcode = code.OpReturnValue
+}
+
+func (c *Compiler) replaceInstruction(pos int, ins []byte) {
+	copy(c.currentInstructions()[pos:], ins)
+}
+
+// changeOperand replaces the operand of an instruction, that has a
+//  single operand
+func (c *Compiler) changeOperand(pos int, operand int) {
+	op := code.Opcode(c.currentInstructions()[pos])
+	c.checkOperands(op, operand)
+	c.replaceInstruction(pos, code.Make(op, operand))
+}
+
+// checkOperands keeps the first operand that does not fit in its
+//  instruction, so Compile returns it
+func (c *Compiler) checkOperands(op code.Opcode, operands ...int) {
+	if err := code.CheckOperands(op, operands...); err != nil && c.err == nil {
+		c.err = err
+	}
+}
+
+// enterScope starts the compilation of a function
+func (c *Compiler) enterScope() {
+	c.scopes = append(c.scopes, compilationScope{})
+	c.scopeIndex += 1
+	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
+}
+
+// leaveScope ends the compilation of a function, and returns its
+//  instructions
+func (c *Compiler) leaveScope() code.Instructions {
+	instructions := c.currentInstructions()
+
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.scopeIndex -= 1
+	c.symbolTable = c.symbolTable.Outer
+
+	return instructions
+}
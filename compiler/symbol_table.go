@@ -0,0 +1,144 @@
+package compiler
+
+// SymbolScope is where the value of a symbol is stored
+type SymbolScope string
+
+const (
+	// GlobalScope symbols are stored in the globals of the vm
+	GlobalScope SymbolScope = "GLOBAL"
+
+	// LocalScope symbols are stored in the frame of a function call
+	LocalScope SymbolScope = "LOCAL"
+
+	// FreeScope symbols are locals of an outer function, that the
+	//  closure captured when it was created
+	FreeScope SymbolScope = "FREE"
+
+	// FunctionScope is the name of the function that is compiled, so it
+	//  can call itself before its binding is set
+	FunctionScope SymbolScope = "FUNCTION"
+)
+
+// Symbol is a name and the slot of its value in its scope
+type Symbol struct {
+	Name  string
+	Scope SymbolScope
+	Index int
+}
+
+// SymbolTable holds the names defined in a function, or in the program
+// Every function has its own table, that falls back to the outer table
+//  for names it does not define
+type SymbolTable struct {
+	Outer *SymbolTable
+
+	store          map[string]Symbol
+	numDefinitions int
+
+	// The names of the slots, so the vm can report the slots that were
+	//  never set
+	names []string
+
+	// FreeSymbols are the outer symbols used by the function, in the
+	//  order the closure captures them
+	FreeSymbols []Symbol
+}
+
+// NewSymbolTable creates the table of the program
+func NewSymbolTable() *SymbolTable {
+	return &SymbolTable{store: make(map[string]Symbol)}
+}
+
+// NewEnclosedSymbolTable creates the table of a function inside another
+//  table
+func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewSymbolTable()
+	s.Outer = outer
+
+	return s
+}
+
+// Define adds a name to the table
+// Names are global in the table of the program, and local in the table
+//  of a function
+// A name that the table already defines keeps its slot, so binding it
+//  again, even in a branch that does not run, sets the same value like
+//  in the evaluator
+func (s *SymbolTable) Define(name string) Symbol {
+	scope := LocalScope
+	if s.Outer == nil {
+		scope = GlobalScope
+	}
+
+	if symbol, ok := s.store[name]; ok && symbol.Scope == scope {
+		return symbol
+	}
+
+	return s.defineSlot(name, scope)
+}
+
+// DefineLater adds a global for a name that is not defined yet
+// The global is set by a later let statement, so a function can use the
+//  globals that are defined after it, and names that are never defined
+//  are runtime errors like in the evaluator
+func (s *SymbolTable) DefineLater(name string) Symbol {
+	for s.Outer != nil {
+		s = s.Outer
+	}
+
+	return s.Define(name)
+}
+
+// DefineParameter adds a parameter of a function, in a new slot
+// Every argument has its own slot, even when two parameters have the
+//  same name
+func (s *SymbolTable) DefineParameter(name string) Symbol {
+	return s.defineSlot(name, LocalScope)
+}
+
+// defineSlot adds a name to the table, in a new slot
+func (s *SymbolTable) defineSlot(name string, scope SymbolScope) Symbol {
+	symbol := Symbol{Name: name, Scope: scope, Index: s.numDefinitions}
+
+	s.store[name] = symbol
+	s.names = append(s.names, name)
+	s.numDefinitions += 1
+
+	return symbol
+}
+
+// DefineFunctionName adds the name of the compiled function
+// It does not take a slot, and local definitions of the same name
+//  shadow it
+func (s *SymbolTable) DefineFunctionName(name string) Symbol {
+	symbol := Symbol{Name: name, Scope: FunctionScope}
+	s.store[name] = symbol
+
+	return symbol
+}
+
+// Resolve finds a name in the table, or in the outer tables
+// Locals of outer functions become free symbols of this table
+func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
+	symbol, ok := s.store[name]
+	if ok || s.Outer == nil {
+		return symbol, ok
+	}
+
+	symbol, ok = s.Outer.Resolve(name)
+	if !ok || symbol.Scope == GlobalScope {
+		return symbol, ok
+	}
+
+	return s.defineFree(symbol), true
+}
+
+// defineFree adds a symbol of an outer function as a free symbol
+func (s *SymbolTable) defineFree(original Symbol) Symbol {
+	s.FreeSymbols = append(s.FreeSymbols, original)
+
+	symbol := Symbol{Name: original.Name, Scope: FreeScope, Index: len(s.FreeSymbols) - 1}
+	s.store[original.Name] = symbol
+
+	return symbol
+}
@@ -0,0 +1,94 @@
+package compiler
+
+import (
+	"testing"
+)
+
+func TestResolveNestedScopes(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+
+	first := NewEnclosedSymbolTable(global)
+	first.DefineFunctionName("f")
+	first.Define("b")
+
+	second := NewEnclosedSymbolTable(first)
+	second.Define("c")
+
+	tests := []struct {
+		table    *SymbolTable
+		name     string
+		expected Symbol
+	}{
+		{global, "a", Symbol{Name: "a", Scope: GlobalScope, Index: 0}},
+		{first, "a", Symbol{Name: "a", Scope: GlobalScope, Index: 0}},
+		{first, "b", Symbol{Name: "b", Scope: LocalScope, Index: 0}},
+		{first, "f", Symbol{Name: "f", Scope: FunctionScope, Index: 0}},
+		{second, "c", Symbol{Name: "c", Scope: LocalScope, Index: 0}},
+		{second, "b", Symbol{Name: "b", Scope: FreeScope, Index: 0}},
+		{second, "f", Symbol{Name: "f", Scope: FreeScope, Index: 1}},
+		{second, "a", Symbol{Name: "a", Scope: GlobalScope, Index: 0}},
+	}
+
+	for _, tt := range tests {
+		symbol, ok := tt.table.Resolve(tt.name)
+		if !ok {
+			t.Errorf("Found no symbol, while expecting %s to resolve", tt.name)
+			continue
+		}
+		if symbol != tt.expected {
+			t.Errorf("Found %+v, while expecting %+v", symbol, tt.expected)
+		}
+	}
+
+	expected := []Symbol{
+		{Name: "b", Scope: LocalScope, Index: 0},
+		{Name: "f", Scope: FunctionScope, Index: 0},
+	}
+	if len(second.FreeSymbols) != len(expected) {
+		t.Fatalf("Found free symbols %+v, while expecting %+v", second.FreeSymbols, expected)
+	}
+	for i, s := range expected {
+		if second.FreeSymbols[i] != s {
+			t.Errorf("Found free symbol %+v, while expecting %+v", second.FreeSymbols[i], s)
+		}
+	}
+
+	if _, ok := second.Resolve("missing"); ok {
+		t.Errorf("Found a symbol for an undefined name")
+	}
+}
+
+func TestDefineTwice(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+	global.Define("b")
+
+	expected := Symbol{Name: "a", Scope: GlobalScope, Index: 0}
+	if symbol := global.Define("a"); symbol != expected {
+		t.Errorf("Found %+v, while expecting %+v", symbol, expected)
+	}
+
+	// Parameters always take a new slot
+	local := NewEnclosedSymbolTable(global)
+	local.DefineParameter("x")
+	expected = Symbol{Name: "x", Scope: LocalScope, Index: 1}
+	if symbol := local.DefineParameter("x"); symbol != expected {
+		t.Errorf("Found %+v, while expecting %+v", symbol, expected)
+	}
+
+	if global.numDefinitions != 2 || local.numDefinitions != 2 {
+		t.Errorf("Found %d and %d slots, while expecting 2 and 2", global.numDefinitions, local.numDefinitions)
+	}
+}
+
+func TestShadowFunctionName(t *testing.T) {
+	table := NewEnclosedSymbolTable(NewSymbolTable())
+	table.DefineFunctionName("a")
+	table.Define("a")
+
+	expected := Symbol{Name: "a", Scope: LocalScope, Index: 0}
+	if symbol, _ := table.Resolve("a"); symbol != expected {
+		t.Errorf("Found %+v, while expecting %+v", symbol, expected)
+	}
+}
@@ -0,0 +1,77 @@
+package diagnostic
+
+import (
+	"fmt"
+
+	"github.com/shavit/go-interpreter/token"
+)
+
+type Severity int
+
+const (
+	Error Severity = iota
+	Warning
+	Note
+)
+
+// String returns the name of the severity as printed in diagnostics
+func (s Severity) String() string {
+	switch s {
+	case Error:
+		return "error"
+	case Warning:
+		return "warning"
+	case Note:
+		return "note"
+	default:
+		return fmt.Sprintf("severity(%d)", int(s))
+	}
+}
+
+// Code identifies the kind of a diagnostic, so tools can match on it
+//  without parsing the message
+type Code string
+
+const (
+	// Lexer errors
+	ErrIllegalCharacter    Code = "E101"
+	ErrUnterminatedString  Code = "E102"
+	ErrInvalidEscape       Code = "E103"
+	ErrUnterminatedComment Code = "E104"
+	ErrInvalidUTF8         Code = "E105"
+	ErrRead                Code = "E106"
+	ErrMalformedNumber     Code = "E107"
+
+	// Parser errors
+	ErrUnexpectedToken Code = "E201"
+	ErrNoPrefixParseFn Code = "E202"
+	ErrInvalidInteger  Code = "E203"
+	ErrUnexpectedEOF   Code = "E204"
+	ErrTooManyErrors   Code = "E205"
+	ErrInvalidFloat    Code = "E206"
+)
+
+// Diagnostic describes a problem in the source
+type Diagnostic struct {
+	Severity Severity
+	Code     Code
+	Message  string
+
+	// Start and End are the span of the problem. End is the position
+	//  right after the last character
+	Start token.Position
+	End   token.Position
+
+	// Expected and Found are the token types of unexpected tokens
+	// Expected is empty when any other token would have been valid
+	Expected token.TokenType
+	Found    token.TokenType
+
+	// Hint is an optional suggestion on how to fix the problem
+	Hint string
+}
+
+// Error returns the diagnostic in a single line
+func (d Diagnostic) Error() string {
+	return fmt.Sprintf("%s: %s[%s]: %s", d.Start, d.Severity, d.Code, d.Message)
+}
@@ -0,0 +1,60 @@
+package diagnostic
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/shavit/go-interpreter/token"
+)
+
+func TestRender(t *testing.T) {
+	src := "let x = 1;\n\tlet 5 = 4;\n"
+	d := Diagnostic{
+		Severity: Error,
+		Code:     ErrUnexpectedToken,
+		Message:  "Found INT, while expecting the next token to be IDENT",
+		Start:    token.Position{Filename: "main.mk", Offset: 16, Line: 2, Column: 6},
+		End:      token.Position{Filename: "main.mk", Offset: 17, Line: 2, Column: 7},
+		Expected: token.IDENT,
+		Found:    token.INT,
+		Hint:     "use a name",
+	}
+
+	expected := "main.mk:2:6: error[E201]: Found INT, while expecting the next token to be IDENT\n" +
+		" 2 | \tlet 5 = 4;\n" +
+		"   | \t    ^\n" +
+		"   = hint: use a name\n"
+
+	var buf bytes.Buffer
+	if err := Render(&buf, src, d); err != nil {
+		t.Fatalf("Found error %v", err)
+	}
+
+	if buf.String() != expected {
+		t.Errorf("Found %q, while expecting %q", buf.String(), expected)
+	}
+}
+
+func TestRenderSpan(t *testing.T) {
+	src := "foo + barbaz"
+	d := Diagnostic{
+		Severity: Warning,
+		Code:     ErrNoPrefixParseFn,
+		Message:  "Message",
+		Start:    token.Position{Offset: 6, Line: 1, Column: 7},
+		End:      token.Position{Offset: 12, Line: 1, Column: 13},
+	}
+
+	expected := "1:7: warning[E202]: Message\n" +
+		" 1 | foo + barbaz\n" +
+		"   |       ^^^^^^\n"
+
+	var buf bytes.Buffer
+	if err := Render(&buf, src, d); err != nil {
+		t.Fatalf("Found error %v", err)
+	}
+
+	if buf.String() != expected {
+		t.Errorf("Found %q, while expecting %q", buf.String(), expected)
+	}
+}
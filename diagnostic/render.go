@@ -0,0 +1,100 @@
+package diagnostic
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Render prints the diagnostic along with the offending line from the
+//  source, and underlines the span with carets
+//
+//	main.mk:1:5: error[E201]: Found INT, while expecting ...
+//	 1 | let 5 = 4;
+//	   |     ^
+//	   = hint: ...
+func Render(w io.Writer, src string, d Diagnostic) error {
+	if _, err := fmt.Fprintln(w, d.Error()); err != nil {
+		return err
+	}
+
+	line, ok := sourceLine(src, d.Start.Line)
+	if !ok {
+		return renderHint(w, "", d)
+	}
+
+	number := strconv.Itoa(d.Start.Line)
+	gutter := strings.Repeat(" ", len(number))
+
+	var buf strings.Builder
+	fmt.Fprintf(&buf, " %s | %s\n", number, line)
+	fmt.Fprintf(&buf, " %s | %s%s\n", gutter, padding(line, d.Start.Column), underline(d))
+
+	if _, err := io.WriteString(w, buf.String()); err != nil {
+		return err
+	}
+
+	return renderHint(w, gutter, d)
+}
+
+// renderHint prints the hint below the source line
+func renderHint(w io.Writer, gutter string, d Diagnostic) error {
+	if d.Hint == "" {
+		return nil
+	}
+
+	_, err := fmt.Fprintf(w, " %s = hint: %s\n", gutter, d.Hint)
+	return err
+}
+
+// sourceLine returns a line by its number, starting at 1
+func sourceLine(src string, number int) (string, bool) {
+	if number < 1 {
+		return "", false
+	}
+
+	lines := strings.Split(src, "\n")
+	if number > len(lines) {
+		return "", false
+	}
+
+	return strings.TrimRight(lines[number-1], "\r"), true
+}
+
+// padding returns the white space before a column, keeping tabs so the
+//  carets line up with the source line
+func padding(line string, column int) string {
+	var buf strings.Builder
+
+	i := 1
+	for _, r := range line {
+		if i >= column {
+			break
+		}
+		if r == '\t' {
+			buf.WriteRune('\t')
+		} else {
+			buf.WriteRune(' ')
+		}
+		i += 1
+	}
+
+	// The column can be past the end of the line, for example at EOF
+	for ; i < column; i++ {
+		buf.WriteRune(' ')
+	}
+
+	return buf.String()
+}
+
+// underline returns the carets under the span
+// Spans over multiple lines or empty spans get a single caret
+func underline(d Diagnostic) string {
+	width := 1
+	if d.End.Line == d.Start.Line && d.End.Column > d.Start.Column {
+		width = d.End.Column - d.Start.Column
+	}
+
+	return strings.Repeat("^", width)
+}
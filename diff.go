@@ -0,0 +1,227 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Lines of context around the changes of a diff
+const diffContext = 3
+
+// edit is a line of a diff, that is kept, deleted or inserted
+type edit struct {
+	op   byte // ' ', '-' or '+'
+	line string
+}
+
+// diff returns the changes between two versions of a file in the unified
+//  format, or an empty string when they are equal
+func diff(filename, a, b string) string {
+	if a == b {
+		return ""
+	}
+
+	edits := diffLines(splitLines(a), splitLines(b))
+
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "--- %s.orig\n+++ %s\n", filename, filename)
+
+	// Line numbers of the edit in both versions
+	lineA, lineB := 1, 1
+
+	for start := 0; start < len(edits); {
+		// Find the next change, and the context before it
+		i := start
+		for i < len(edits) && edits[i].op == ' ' {
+			i += 1
+		}
+		if i == len(edits) {
+			break
+		}
+
+		from := max(start, i-diffContext)
+		lineA += from - start
+		lineB += from - start
+
+		// Extend the hunk until the unchanged lines between two changes
+		//  are more than twice the context
+		end := i
+		for unchanged := 0; end < len(edits) && unchanged <= 2*diffContext; end += 1 {
+			if edits[end].op == ' ' {
+				unchanged += 1
+			} else {
+				unchanged = 0
+			}
+		}
+		to := end
+		for to > i && edits[to-1].op == ' ' {
+			to -= 1
+		}
+		to = min(to+diffContext, len(edits))
+
+		countA, countB := 0, 0
+		for _, e := range edits[from:to] {
+			if e.op != '+' {
+				countA += 1
+			}
+			if e.op != '-' {
+				countB += 1
+			}
+		}
+
+		fmt.Fprintf(&buf, "@@ -%d,%d +%d,%d @@\n", lineA, countA, lineB, countB)
+		for _, e := range edits[from:to] {
+			fmt.Fprintf(&buf, "%c%s\n", e.op, e.line)
+		}
+
+		lineA += countA
+		lineB += countB
+		start = to
+	}
+
+	return buf.String()
+}
+
+// splitLines splits a text into lines, without the new line characters
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// maxDiffEdits is the number of changed lines after which diffLines
+//  stops looking for the shortest diff, so the memory of the search
+//  stays bounded on large files that changed everywhere
+const maxDiffEdits = 1000
+
+// diffLines finds the edits from a to b
+// The common prefix and suffix are kept, and the lines between them
+//  are compared with the Myers algorithm
+func diffLines(a, b []string) []edit {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix += 1
+	}
+
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix += 1
+	}
+
+	var edits []edit
+	for _, line := range a[:prefix] {
+		edits = append(edits, edit{' ', line})
+	}
+	edits = append(edits, myers(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, line := range a[len(a)-suffix:] {
+		edits = append(edits, edit{' ', line})
+	}
+
+	return edits
+}
+
+// myers finds the shortest edits from a to b
+// Every step d finds the furthest line of a that can be reached on
+//  each diagonal k = x - y with d edits, and the steps are kept to walk
+//  back from the end. Above maxDiffEdits, a is replaced by b as a whole
+func myers(a, b []string) []edit {
+	n, m := len(a), len(b)
+
+	// v[k+offset] is the furthest x on the diagonal k
+	offset := n + m + 1
+	v := make([]int, 2*offset+1)
+
+	// trace[d][k+d] is v after the step d, until the step that reaches
+	//  the end
+	var trace [][]int
+
+	for d := 0; d <= n+m; d++ {
+		if d > maxDiffEdits {
+			return replaceLines(a, b)
+		}
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || k != d && v[k-1+offset] < v[k+1+offset] {
+				x = v[k+1+offset]
+			} else {
+				x = v[k-1+offset] + 1
+			}
+
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x += 1
+				y += 1
+			}
+			v[k+offset] = x
+
+			if x >= n && y >= m {
+				return backtrack(a, b, trace)
+			}
+		}
+
+		trace = append(trace, append([]int(nil), v[offset-d:offset+d+1]...))
+	}
+
+	return replaceLines(a, b)
+}
+
+// backtrack walks the steps of myers back from the end, and returns the
+//  edits in order
+func backtrack(a, b []string, trace [][]int) []edit {
+	var edits []edit
+	x, y := len(a), len(b)
+
+	for d := len(trace); d > 0; d-- {
+		prev := trace[d-1]
+		k := x - y
+
+		// The step came from the diagonal above, an insertion, or the
+		//  one below, a deletion
+		prevK := k - 1
+		if k == -d || k != d && prev[k-1+d-1] < prev[k+1+d-1] {
+			prevK = k + 1
+		}
+		prevX := prev[prevK+d-1]
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			edits = append(edits, edit{' ', a[x-1]})
+			x -= 1
+			y -= 1
+		}
+
+		if prevK == k+1 {
+			edits = append(edits, edit{'+', b[y-1]})
+		} else {
+			edits = append(edits, edit{'-', a[x-1]})
+		}
+		x, y = prevX, prevY
+	}
+
+	for x > 0 {
+		edits = append(edits, edit{' ', a[x-1]})
+		x -= 1
+	}
+
+	for i, j := 0, len(edits)-1; i < j; i, j = i+1, j-1 {
+		edits[i], edits[j] = edits[j], edits[i]
+	}
+
+	return edits
+}
+
+// replaceLines deletes every line of a, and inserts every line of b
+func replaceLines(a, b []string) []edit {
+	edits := make([]edit, 0, len(a)+len(b))
+	for _, line := range a {
+		edits = append(edits, edit{'-', line})
+	}
+	for _, line := range b {
+		edits = append(edits, edit{'+', line})
+	}
+
+	return edits
+}
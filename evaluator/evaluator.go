@@ -0,0 +1,536 @@
+package evaluator
+
+import (
+	"fmt"
+
+	"github.com/shavit/go-interpreter/ast"
+	"github.com/shavit/go-interpreter/object"
+)
+
+// Booleans and null never change, so there is no need to allocate
+//  new objects for them
+var (
+	NULL  = &object.Null{}
+	TRUE  = &object.Boolean{Value: true}
+	FALSE = &object.Boolean{Value: false}
+)
+
+// MaxCallDepth is the number of nested function calls after which the
+//  evaluation stops, before the Go stack runs out
+// It is the same as the frames limit of the vm
+const MaxCallDepth = 1 << 14
+
+// Eval evaluates a node within an environment and returns its value
+func Eval(node ast.Node, env *object.Environment) object.Object {
+	switch node := node.(type) {
+	// Statements
+	case *ast.Program:
+		return evalProgram(node, env)
+	case *ast.ExpressionStatement:
+		return Eval(node.Expression, env)
+	case *ast.BlockStatement:
+		return evalBlockStatement(node, env)
+	case *ast.LetStatement:
+		val := evalOrNull(node.Value, env)
+		if isErrorOrReturn(val) {
+			return val
+		}
+		env.Set(node.Name.Value, val)
+		return NULL
+	case *ast.ReturnStatement:
+		val := evalOrNull(node.ReturnValue, env)
+		if isErrorOrReturn(val) {
+			return val
+		}
+		return &object.ReturnValue{Value: val}
+	case *ast.BadStatement:
+		return newError("Syntax error at %s", node.Token.Pos)
+
+	// Expressions
+	case *ast.IntegerLiteral:
+		return &object.Integer{Value: node.Value}
+	case *ast.FloatLiteral:
+		return &object.Float{Value: node.Value}
+	case *ast.StringLiteral:
+		return &object.String{Value: node.Value}
+	case *ast.BooleanLiteral:
+		return nativeBoolToBooleanObject(node.Value)
+	case *ast.Identifier:
+		return evalIdentifier(node, env)
+	case *ast.PrefixExpression:
+		right := Eval(node.Right, env)
+		if isErrorOrReturn(right) {
+			return right
+		}
+		return evalPrefixExpression(node.Operator, right)
+	case *ast.InfixExpression:
+		left := Eval(node.Left, env)
+		if isErrorOrReturn(left) {
+			return left
+		}
+		right := Eval(node.Right, env)
+		if isErrorOrReturn(right) {
+			return right
+		}
+		return evalInfixExpression(node.Operator, left, right)
+	case *ast.LogicalExpression:
+		return evalLogicalExpression(node, env)
+	case *ast.IfExpression:
+		return evalIfExpression(node, env)
+	case *ast.FunctionLiteral:
+		return &object.Function{Parameters: node.Parameters, Body: node.Body, Env: env}
+	case *ast.CallExpression:
+		function := Eval(node.Function, env)
+		if isErrorOrReturn(function) {
+			return function
+		}
+		args := evalExpressions(node.Arguments, env)
+		if len(args) == 1 && isErrorOrReturn(args[0]) {
+			return args[0]
+		}
+		return applyFunction(function, args, env)
+	case *ast.ArrayLiteral:
+		elements := evalExpressions(node.Elements, env)
+		if len(elements) == 1 && isErrorOrReturn(elements[0]) {
+			return elements[0]
+		}
+		return &object.Array{Elements: elements}
+	case *ast.HashLiteral:
+		return evalHashLiteral(node, env)
+	case *ast.IndexExpression:
+		left := Eval(node.Left, env)
+		if isErrorOrReturn(left) {
+			return left
+		}
+		index := Eval(node.Index, env)
+		if isErrorOrReturn(index) {
+			return index
+		}
+		return evalIndexExpression(left, index)
+	case *ast.BadExpression:
+		return newError("Syntax error at %s", node.Token.Pos)
+	}
+
+	return nil
+}
+
+// evalOrNull evaluates an optional expression
+// The parser leaves missing expressions as nil
+func evalOrNull(exp ast.Expression, env *object.Environment) object.Object {
+	if exp == nil {
+		return NULL
+	}
+
+	val := Eval(exp, env)
+	if val == nil {
+		return NULL
+	}
+
+	return val
+}
+
+// evalProgram evaluates the statements in order, and stops at the first
+//  return statement or error
+func evalProgram(program *ast.Program, env *object.Environment) object.Object {
+	var result object.Object
+
+	for _, stmt := range program.Statements {
+		result = Eval(stmt, env)
+
+		switch result := result.(type) {
+		case *object.ReturnValue:
+			return result.Value
+		case *object.Error:
+			return result
+		}
+	}
+
+	return result
+}
+
+// evalBlockStatement evaluates the statements of a block
+// Unlike evalProgram, it keeps return values wrapped so the outer
+//  blocks stop as well
+func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) object.Object {
+	var result object.Object = NULL
+
+	for _, stmt := range block.Statements {
+		result = Eval(stmt, env)
+
+		if result != nil {
+			rt := result.Type()
+			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
+				return result
+			}
+		}
+	}
+
+	return result
+}
+
+// evalIfExpression evaluates the consequence when the condition is
+//  truthy, otherwise the alternative or null
+func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
+	condition := Eval(ie.Condition, env)
+	if isErrorOrReturn(condition) {
+		return condition
+	}
+
+	if isTruthy(condition) {
+		return Eval(ie.Consequence, env)
+	} else if ie.Alternative != nil {
+		return Eval(ie.Alternative, env)
+	} else {
+		return NULL
+	}
+}
+
+// evalLogicalExpression evaluates the right expression only when the
+//  left one does not decide the result
+// The result is true or false, from the truthiness of the operands
+func evalLogicalExpression(node *ast.LogicalExpression, env *object.Environment) object.Object {
+	left := Eval(node.Left, env)
+	if isErrorOrReturn(left) {
+		return left
+	}
+
+	if node.Operator == "&&" && !isTruthy(left) || node.Operator == "||" && isTruthy(left) {
+		return nativeBoolToBooleanObject(isTruthy(left))
+	}
+
+	right := Eval(node.Right, env)
+	if isErrorOrReturn(right) {
+		return right
+	}
+
+	return nativeBoolToBooleanObject(isTruthy(right))
+}
+
+// evalIdentifier looks up the value bound to the identifier
+func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
+	val, ok := env.Get(node.Value)
+	if !ok {
+		return newError("Identifier not found: %s", node.Value)
+	}
+
+	return val
+}
+
+// evalPrefixExpression applies a prefix operator on the right value
+func evalPrefixExpression(operator string, right object.Object) object.Object {
+	switch operator {
+	case "!":
+		return evalBangOperatorExpression(right)
+	case "-":
+		return evalMinusPrefixOperatorExpression(right)
+	default:
+		return newError("Unknown operator: %s%s", operator, right.Type())
+	}
+}
+
+// evalBangOperatorExpression negates the truthiness of the value
+func evalBangOperatorExpression(right object.Object) object.Object {
+	return nativeBoolToBooleanObject(!isTruthy(right))
+}
+
+// evalMinusPrefixOperatorExpression negates an integer or a float
+func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
+	switch right := right.(type) {
+	case *object.Integer:
+		return &object.Integer{Value: -right.Value}
+	case *object.Float:
+		return &object.Float{Value: -right.Value}
+	default:
+		return newError("Unknown operator: -%s", right.Type())
+	}
+}
+
+// evalInfixExpression applies an infix operator on both values
+func evalInfixExpression(operator string, left, right object.Object) object.Object {
+	switch {
+	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
+		return evalIntegerInfixExpression(operator, left, right)
+	case isNumber(left) && isNumber(right):
+		return evalFloatInfixExpression(operator, left, right)
+	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
+		return evalStringInfixExpression(operator, left, right)
+	case left.Type() != right.Type():
+		return newError("Type mismatch: %s %s %s", left.Type(), operator, right.Type())
+	// Booleans and null are singletons, so they can be compared by
+	//  their pointers
+	case operator == "==":
+		return nativeBoolToBooleanObject(left == right)
+	case operator == "!=":
+		return nativeBoolToBooleanObject(left != right)
+	default:
+		return newError("Unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+// evalIntegerInfixExpression applies arithmetic and comparison operators
+//  on two integers
+func evalIntegerInfixExpression(operator string, left, right object.Object) object.Object {
+	leftVal := left.(*object.Integer).Value
+	rightVal := right.(*object.Integer).Value
+
+	switch operator {
+	case "+":
+		return &object.Integer{Value: leftVal + rightVal}
+	case "-":
+		return &object.Integer{Value: leftVal - rightVal}
+	case "*":
+		return &object.Integer{Value: leftVal * rightVal}
+	case "/":
+		if rightVal == 0 {
+			return newError("Division by zero: %d / %d", leftVal, rightVal)
+		}
+		return &object.Integer{Value: leftVal / rightVal}
+	case "<":
+		return nativeBoolToBooleanObject(leftVal < rightVal)
+	case ">":
+		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	default:
+		return newError("Unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+// evalFloatInfixExpression applies arithmetic and comparison operators
+//  on two numbers, where at least one is a float
+// The integer is converted to a float, so the result is a float
+func evalFloatInfixExpression(operator string, left, right object.Object) object.Object {
+	leftVal := toFloat(left)
+	rightVal := toFloat(right)
+
+	switch operator {
+	case "+":
+		return &object.Float{Value: leftVal + rightVal}
+	case "-":
+		return &object.Float{Value: leftVal - rightVal}
+	case "*":
+		return &object.Float{Value: leftVal * rightVal}
+	case "/":
+		if rightVal == 0 {
+			return newError("Division by zero: %s / %s", left.Inspect(), right.Inspect())
+		}
+		return &object.Float{Value: leftVal / rightVal}
+	case "<":
+		return nativeBoolToBooleanObject(leftVal < rightVal)
+	case ">":
+		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	default:
+		return newError("Unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+// isNumber checks if the object is an integer or a float
+func isNumber(obj object.Object) bool {
+	return obj.Type() == object.INTEGER_OBJ || obj.Type() == object.FLOAT_OBJ
+}
+
+// toFloat converts a number to a float
+func toFloat(obj object.Object) float64 {
+	if integer, ok := obj.(*object.Integer); ok {
+		return float64(integer.Value)
+	}
+
+	return obj.(*object.Float).Value
+}
+
+// evalExpressions evaluates the expressions from left to right
+// It stops on the first error or return value, and returns it as the
+//  only value
+func evalExpressions(exps []ast.Expression, env *object.Environment) []object.Object {
+	var result []object.Object
+
+	for _, e := range exps {
+		evaluated := Eval(e, env)
+		if isErrorOrReturn(evaluated) {
+			return []object.Object{evaluated}
+		}
+		result = append(result, evaluated)
+	}
+
+	return result
+}
+
+// evalHashLiteral evaluates the keys and values in the order of the
+//  source
+// Later pairs replace the values of duplicate keys
+func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
+	hash := object.NewHash()
+
+	for _, pair := range node.Pairs {
+		key := Eval(pair.Key, env)
+		if isErrorOrReturn(key) {
+			return key
+		}
+
+		value := Eval(pair.Value, env)
+		if isErrorOrReturn(value) {
+			return value
+		}
+
+		hashable, ok := key.(object.Hashable)
+		if !ok {
+			return newError("Unusable as hash key: %s", key.Type())
+		}
+
+		hash.Set(hashable, value)
+	}
+
+	return hash
+}
+
+// evalIndexExpression returns the element of an array or the value of
+//  a hash key
+func evalIndexExpression(left, index object.Object) object.Object {
+	switch left := left.(type) {
+	case *object.Array:
+		return evalArrayIndexExpression(left, index)
+	case *object.Hash:
+		return evalHashIndexExpression(left, index)
+	default:
+		return newError("Index operator not supported: %s", left.Type())
+	}
+}
+
+// evalHashIndexExpression returns the value of a key, or null for
+//  missing keys
+func evalHashIndexExpression(hash *object.Hash, index object.Object) object.Object {
+	key, ok := index.(object.Hashable)
+	if !ok {
+		return newError("Unusable as hash key: %s", index.Type())
+	}
+
+	value, ok := hash.Get(key)
+	if !ok {
+		return NULL
+	}
+
+	return value
+}
+
+// evalArrayIndexExpression returns the element of an array at an index
+// Negative indices count from the end of the array
+func evalArrayIndexExpression(array *object.Array, index object.Object) object.Object {
+	integer, ok := index.(*object.Integer)
+	if !ok {
+		return newError("Index must be an integer: %s", index.Type())
+	}
+
+	i, length := integer.Value, int64(len(array.Elements))
+	if i < 0 {
+		i += length
+	}
+	if i < 0 || i >= length {
+		return newError("Index out of range: %d, the array has %d elements", integer.Value, length)
+	}
+
+	return array.Elements[i]
+}
+
+// applyFunction calls a function with its arguments, from the
+//  environment of the caller
+func applyFunction(fn object.Object, args []object.Object, caller *object.Environment) object.Object {
+	function, ok := fn.(*object.Function)
+	if !ok {
+		return newError("Not a function: %s", fn.Type())
+	}
+
+	if len(args) != len(function.Parameters) {
+		return newError("Wrong number of arguments: found %d, while expecting %d", len(args), len(function.Parameters))
+	}
+
+	if caller.Depth() >= MaxCallDepth {
+		return newError("Stack overflow: more than %d calls", MaxCallDepth)
+	}
+
+	env := extendFunctionEnv(function, args, caller)
+	evaluated := Eval(function.Body, env)
+
+	return unwrapReturnValue(evaluated)
+}
+
+// extendFunctionEnv binds the arguments to the parameter names, in a new
+//  environment enclosed by the environment of the function
+func extendFunctionEnv(fn *object.Function, args []object.Object, caller *object.Environment) *object.Environment {
+	env := object.NewCallEnvironment(fn.Env, caller)
+
+	for i, param := range fn.Parameters {
+		env.Set(param.Value, args[i])
+	}
+
+	return env
+}
+
+// unwrapReturnValue stops the return value from leaving the function,
+//  otherwise it would stop the evaluation of the caller
+func unwrapReturnValue(obj object.Object) object.Object {
+	if returnValue, ok := obj.(*object.ReturnValue); ok {
+		return returnValue.Value
+	}
+
+	return obj
+}
+
+// evalStringInfixExpression concatenates and compares two strings
+func evalStringInfixExpression(operator string, left, right object.Object) object.Object {
+	leftVal := left.(*object.String).Value
+	rightVal := right.(*object.String).Value
+
+	switch operator {
+	case "+":
+		return &object.String{Value: leftVal + rightVal}
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	default:
+		return newError("Unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+// nativeBoolToBooleanObject returns one of the boolean singletons
+func nativeBoolToBooleanObject(input bool) *object.Boolean {
+	if input {
+		return TRUE
+	}
+
+	return FALSE
+}
+
+// isTruthy checks if a value is considered true
+// Only false and null are falsy
+func isTruthy(obj object.Object) bool {
+	switch obj {
+	case NULL, FALSE:
+		return false
+	default:
+		return true
+	}
+}
+
+// newError creates a new error object with a formatted message
+func newError(format string, a ...interface{}) *object.Error {
+	return &object.Error{Message: fmt.Sprintf(format, a...)}
+}
+
+// isErrorOrReturn checks if the object is an error, or the value of a
+//  return statement inside an if expression
+// Both stop the evaluation of the expressions around them, up to the
+//  function or the program
+func isErrorOrReturn(obj object.Object) bool {
+	if obj == nil {
+		return false
+	}
+
+	return obj.Type() == object.ERROR_OBJ || obj.Type() == object.RETURN_VALUE_OBJ
+}
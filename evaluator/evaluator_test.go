@@ -0,0 +1,556 @@
+package evaluator
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/shavit/go-interpreter/lexer"
+	"github.com/shavit/go-interpreter/object"
+	"github.com/shavit/go-interpreter/parser"
+)
+
+func TestEvalIntegerExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"7", 7},
+		{"-12", -12},
+		{"--4", 4},
+		{"2 + 3 * 4", 14},
+		{"20 / 4 - 1", 4},
+		{"-5 + 10 * 2 - 3", 12},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		testIntegerObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestEvalBooleanExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"true", true},
+		{"false", false},
+		{"1 < 2", true},
+		{"1 > 2", false},
+		{"3 == 3", true},
+		{"3 != 3", false},
+		{"true == true", true},
+		{"true != false", true},
+		{"1 < 2 == true", true},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		testBooleanObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestBangOperator(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"!true", false},
+		{"!false", true},
+		{"!5", false},
+		{"!!true", true},
+		{"!!5", true},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		testBooleanObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestEvalFloatExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"3.14", 3.14},
+		{"-.5", -0.5},
+		{"1.5 * 2", 3},
+		{"10 / 4.0", 2.5},
+		{"1 + 1e-1", 1.1},
+		{"2.5 - 1 * 2", 0.5},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+
+		result, ok := evaluated.(*object.Float)
+		if !ok {
+			t.Errorf("Found %T(%+v), while expecting *object.Float for %q", evaluated, evaluated, tt.input)
+			continue
+		}
+		if result.Value != tt.expected {
+			t.Errorf("Found %g, while expecting %g for %q", result.Value, tt.expected, tt.input)
+		}
+	}
+
+	// Integers stay integers, unless they are mixed with floats
+	testIntegerObject(t, testEval(t, "10 / 4"), 2)
+	testBooleanObject(t, testEval(t, "1 == 1.0"), true)
+	testBooleanObject(t, testEval(t, "0.5 < 1"), true)
+}
+
+func TestErrorHandling(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"5 + true", "Type mismatch: INTEGER + BOOLEAN"},
+		{"5 + true; 5", "Type mismatch: INTEGER + BOOLEAN"},
+		{"-true", "Unknown operator: -BOOLEAN"},
+		{"true + false", "Unknown operator: BOOLEAN + BOOLEAN"},
+		{"10 / 0", "Division by zero: 10 / 0"},
+		{"missing", "Identifier not found: missing"},
+		{`"a" - "b"`, "Unknown operator: STRING - STRING"},
+		{`"a" + 1`, "Type mismatch: STRING + INTEGER"},
+		{"1.5 / 0", "Division by zero: 1.5 / 0"},
+		{"-true + 1.5", "Unknown operator: -BOOLEAN"},
+		{"2.5 + false", "Type mismatch: FLOAT + BOOLEAN"},
+		{"[1, 2, 3][3]", "Index out of range: 3, the array has 3 elements"},
+		{"[1, 2, 3][-4]", "Index out of range: -4, the array has 3 elements"},
+		{"[][0]", "Index out of range: 0, the array has 0 elements"},
+		{`[1]["0"]`, "Index must be an integer: STRING"},
+		{"1[0]", "Index operator not supported: INTEGER"},
+		{"[1, missing]", "Identifier not found: missing"},
+		{`{"name": "x"}[fn(x) { x }]`, "Unusable as hash key: FUNCTION"},
+		{`{fn(x) { x }: 1}`, "Unusable as hash key: FUNCTION"},
+		{`{[1]: 1}`, "Unusable as hash key: ARRAY"},
+		{`{1.5: 1}`, "Unusable as hash key: FLOAT"},
+		{`{"a": missing}`, "Identifier not found: missing"},
+		{"missing && false", "Identifier not found: missing"},
+		{"true && 1 / 0", "Division by zero: 1 / 0"},
+		{"false || missing", "Identifier not found: missing"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("Found %T(%+v), while expecting *object.Error", evaluated, evaluated)
+			continue
+		}
+
+		if errObj.Message != tt.expected {
+			t.Errorf("Found %q, while expecting %q", errObj.Message, tt.expected)
+		}
+	}
+}
+
+func TestLetStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let a = 6; a;", 6},
+		{"let a = 6 * 7; a;", 42},
+		{"let a = 6; let b = a; b;", 6},
+		{"let a = 6; let b = a; let c = a + b + 4; c;", 16},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(t, tt.input), tt.expected)
+	}
+}
+
+func TestReturnStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"return 10;", 10},
+		{"return 10; 9;", 10},
+		{"return 2 * 5; 9;", 10},
+		{"9; return 2 * 5; 9;", 10},
+		{"let a = 6; return a * a; missing", 36},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(t, tt.input), tt.expected)
+	}
+}
+
+func testEval(t *testing.T, input string) object.Object {
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if errors := p.Errors(); len(errors) > 0 {
+		t.Fatalf("Found parser errors for %q: %v", input, errors)
+	}
+
+	return Eval(program, object.NewEnvironment())
+}
+
+func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
+	result, ok := obj.(*object.Integer)
+	if !ok {
+		t.Errorf("Found %T(%+v), while expecting *object.Integer", obj, obj)
+		return false
+	}
+
+	if result.Value != expected {
+		t.Errorf("Found %d, while expecting %d", result.Value, expected)
+		return false
+	}
+
+	return true
+}
+
+func testBooleanObject(t *testing.T, obj object.Object, expected bool) bool {
+	result, ok := obj.(*object.Boolean)
+	if !ok {
+		t.Errorf("Found %T(%+v), while expecting *object.Boolean", obj, obj)
+		return false
+	}
+
+	if result.Value != expected {
+		t.Errorf("Found %t, while expecting %t", result.Value, expected)
+		return false
+	}
+
+	return true
+}
+
+func TestIfElseExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"if (true) { 10 }", 10},
+		{"if (false) { 10 }", nil},
+		{"if (1) { 10 }", 10},
+		{"if (1 < 2) { 10 }", 10},
+		{"if (1 > 2) { 10 }", nil},
+		{"if (1 > 2) { 10 } else { 20 }", 20},
+		{"if (1 < 2) { 10 } else { 20 }", 10},
+		{"if (1 < 2) { }", nil},
+		{"(1 + 2) * 3", 9},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if integer, ok := tt.expected.(int); ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else if evaluated != NULL {
+			t.Errorf("Found %T(%+v), while expecting NULL", evaluated, evaluated)
+		}
+	}
+}
+
+func TestNestedReturnStatements(t *testing.T) {
+	input := `
+if (10 > 1) {
+  if (10 > 1) {
+    return 10;
+  }
+
+  return 1;
+}
+`
+	testIntegerObject(t, testEval(t, input), 10)
+}
+
+// A return statement inside an if expression returns from the function
+//  or the program, wherever the if expression is
+func TestReturnInsideExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 + if (true) { return 2 }", "2"},
+		{"let f = fn() { let a = if (true) { return 2 }; 5 }; f()", "2"},
+		{"if (if (true) { return false }) { 10 } else { 20 }", "false"},
+		{"-if (true) { return 3 }", "3"},
+		{"let f = fn(x) { x }; f(if (true) { return 4 }) + 1", "4"},
+		{"[1, if (true) { return 5 }, missing]", "5"},
+		{"{1: if (true) { return 6 }}", "6"},
+		{"[1][if (true) { return 7 }]", "7"},
+		{"let f = fn() { (if (true) { return 8 }) && false }; f()", "8"},
+		{"return if (true) { return 9 }", "9"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("Found %q, while expecting %q for %q", evaluated.Inspect(), tt.expected, tt.input)
+		}
+	}
+}
+
+func TestFunctionObject(t *testing.T) {
+	evaluated := testEval(t, "fn(x) { x + 2; };")
+
+	fn, ok := evaluated.(*object.Function)
+	if !ok {
+		t.Fatalf("Found %T(%+v), while expecting *object.Function", evaluated, evaluated)
+	}
+
+	if len(fn.Parameters) != 1 || fn.Parameters[0].String() != "x" {
+		t.Fatalf("Found %v, while expecting parameters [x]", fn.Parameters)
+	}
+
+	if fn.Body.String() != "{ (x + 2) }" {
+		t.Fatalf("Found %q, while expecting %q", fn.Body.String(), "{ (x + 2) }")
+	}
+}
+
+func TestFunctionApplication(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let identity = fn(x) { x; }; identity(5);", 5},
+		{"let identity = fn(x) { return x; }; identity(5);", 5},
+		{"let double = fn(x) { x * 2; }; double(5);", 10},
+		{"let add = fn(x, y) { x + y; }; add(5, 5);", 10},
+		{"let add = fn(x, y) { x + y; }; add(5 + 5, add(5, 5));", 20},
+		{"fn(x) { x; }(5)", 5},
+		{"let early = fn() { return 1; 2 }; early() + 1", 2},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(t, tt.input), tt.expected)
+	}
+}
+
+func TestClosures(t *testing.T) {
+	input := `
+let newAdder = fn(x) {
+  fn(y) { x + y };
+};
+
+let addTwo = newAdder(2);
+addTwo(2);`
+
+	testIntegerObject(t, testEval(t, input), 4)
+}
+
+func TestFunctionErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x = 1; x(2)", "Not a function: INTEGER"},
+		{"fn(x, y) { x }(1)", "Wrong number of arguments: found 1, while expecting 2"},
+		{"fn(x) { x }(-true)", "Unknown operator: -BOOLEAN"},
+		{"let f = fn(n) { f(n + 1) }; f(0)", fmt.Sprintf("Stack overflow: more than %d calls", MaxCallDepth)},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("Found %T(%+v), while expecting *object.Error", evaluated, evaluated)
+			continue
+		}
+
+		if errObj.Message != tt.expected {
+			t.Errorf("Found %q, while expecting %q", errObj.Message, tt.expected)
+		}
+	}
+}
+
+// The deepest recursion stops at the limit, like in the vm
+func TestCallDepth(t *testing.T) {
+	input := "let f = fn(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } };"
+
+	testIntegerObject(t, testEval(t, input+fmt.Sprintf("f(%d)", MaxCallDepth-1)), MaxCallDepth-1)
+
+	evaluated := testEval(t, input+fmt.Sprintf("f(%d)", MaxCallDepth))
+	if errObj, ok := evaluated.(*object.Error); !ok || errObj.Message != fmt.Sprintf("Stack overflow: more than %d calls", MaxCallDepth) {
+		t.Errorf("Found %T(%+v), while expecting a stack overflow", evaluated, evaluated)
+	}
+}
+
+func TestStringExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`"hello world"`, "hello world"},
+		{`"hello" + " " + "world"`, "hello world"},
+		{`let greet = fn(name) { "hi " + name }; greet("\u{1F600}")`, "hi \U0001F600"},
+		{`"a" == "a"`, true},
+		{`"a" != "a"`, false},
+		{`"a" == "b"`, false},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+
+		switch expected := tt.expected.(type) {
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok {
+				t.Errorf("Found %T(%+v), while expecting *object.String", evaluated, evaluated)
+				continue
+			}
+			if str.Value != expected {
+				t.Errorf("Found %q, while expecting %q", str.Value, expected)
+			}
+		}
+	}
+}
+
+func TestArrayLiterals(t *testing.T) {
+	evaluated := testEval(t, "[1, 2 * 2, 3 + 3]")
+
+	array, ok := evaluated.(*object.Array)
+	if !ok {
+		t.Fatalf("Found %T(%+v), while expecting *object.Array", evaluated, evaluated)
+	}
+
+	if len(array.Elements) != 3 {
+		t.Fatalf("Found %d, while expecting 3 elements", len(array.Elements))
+	}
+
+	testIntegerObject(t, array.Elements[0], 1)
+	testIntegerObject(t, array.Elements[1], 4)
+	testIntegerObject(t, array.Elements[2], 6)
+
+	if out := testEval(t, `[1, "a", [true], []]`).Inspect(); out != "[1, a, [true], []]" {
+		t.Errorf("Found %q, while expecting %q", out, "[1, a, [true], []]")
+	}
+}
+
+func TestArrayIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"[1, 2, 3][0]", 1},
+		{"[1, 2, 3][2]", 3},
+		{"let i = 0; [1][i]", 1},
+		{"[1, 2, 3][1 + 1]", 3},
+		{"let a = [1, 2, 3]; a[0] + a[1] + a[2]", 6},
+		{"let a = [1, 2, 3]; let i = a[0]; a[i]", 2},
+		{"[1, 2, 3][-1]", 3},
+		{"[1, 2, 3][-3]", 1},
+		{"[[1, 2], [3, 4]][1][0]", 3},
+		{"let first = fn(a) { a[0] }; first([5, 6])", 5},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(t, tt.input), tt.expected)
+	}
+}
+
+func TestHashLiterals(t *testing.T) {
+	input := `let two = "two";
+{
+  "one": 10 - 9,
+  two: 1 + 1,
+  "thr" + "ee": 6 / 2,
+  4: 4,
+  true: 5,
+  false: 6
+}`
+
+	evaluated := testEval(t, input)
+	hash, ok := evaluated.(*object.Hash)
+	if !ok {
+		t.Fatalf("Found %T(%+v), while expecting *object.Hash", evaluated, evaluated)
+	}
+
+	expected := []struct {
+		key   object.Hashable
+		value int64
+	}{
+		{&object.String{Value: "one"}, 1},
+		{&object.String{Value: "two"}, 2},
+		{&object.String{Value: "three"}, 3},
+		{&object.Integer{Value: 4}, 4},
+		{TRUE, 5},
+		{FALSE, 6},
+	}
+
+	if len(hash.Pairs) != len(expected) {
+		t.Fatalf("Found %d, while expecting %d pairs", len(hash.Pairs), len(expected))
+	}
+
+	for _, tt := range expected {
+		value, ok := hash.Get(tt.key)
+		if !ok {
+			t.Errorf("Found no value for %s", tt.key.Inspect())
+			continue
+		}
+		testIntegerObject(t, value, tt.value)
+	}
+
+	expectedOutput := "{one: 1, two: 2, three: 3, 4: 4, true: 5, false: 6}"
+	if out := hash.Inspect(); out != expectedOutput {
+		t.Errorf("Found %q, while expecting %q", out, expectedOutput)
+	}
+
+	if out := testEval(t, `{"b": 1, "a": 2, "b": 3}`).Inspect(); out != "{b: 3, a: 2}" {
+		t.Errorf("Found %q, while expecting %q", out, "{b: 3, a: 2}")
+	}
+}
+
+func TestHashIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`{"foo": 5}["foo"]`, 5},
+		{`{"foo": 5}["bar"]`, nil},
+		{`let key = "foo"; {"foo": 5}[key]`, 5},
+		{`{}["foo"]`, nil},
+		{"{5: 5}[5]", 5},
+		{"{true: 5}[true]", 5},
+		{"{false: 5}[false]", 5},
+		{`{1: 5}["1"]`, nil},
+		{`{"a": [1, 2]}["a"][-1]`, 2},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if integer, ok := tt.expected.(int); ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else if evaluated != NULL {
+			t.Errorf("Found %T(%+v), while expecting NULL", evaluated, evaluated)
+		}
+	}
+}
+
+func TestLogicalExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"true && true", true},
+		{"true && false", false},
+		{"false && true", false},
+		{"false || false", false},
+		{"false || true", true},
+		{"true || false", true},
+		{"1 && 2", true},
+		{`"" || 0`, true},
+		{"if (false) { 1 } || false", false},
+		{"true || false && false", true},
+		{"(true || false) && false", false},
+		{"1 < 2 && 2 < 3", true},
+		// The right operands are not evaluated
+		{"false && missing", false},
+		{"true || missing", true},
+		{"let x = 0; x != 0 && 10 / x > 1", false},
+		{"let x = 5; x != 0 && 10 / x > 1", true},
+	}
+
+	for _, tt := range tests {
+		testBooleanObject(t, testEval(t, tt.input), tt.expected)
+	}
+}
@@ -0,0 +1,135 @@
+// Package format prints programs in the canonical style
+//
+// The output uses tabs for indentation, one statement per line, and only
+//  the parentheses that the precedence of the operators requires
+package format
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/shavit/go-interpreter/ast"
+	"github.com/shavit/go-interpreter/diagnostic"
+	"github.com/shavit/go-interpreter/lexer"
+	"github.com/shavit/go-interpreter/parser"
+	"github.com/shavit/go-interpreter/token"
+)
+
+// Source formats the source of a script, and keeps its comments
+// It returns the lexer and parser errors when the source cannot be
+//  parsed, since the formatter never changes invalid programs
+func Source(filename string, src []byte) ([]byte, []diagnostic.Diagnostic) {
+	p := parser.New(lexer.NewFile(filename, string(src)))
+	program := p.ParseProgram()
+
+	if errors := p.Errors(); len(errors) > 0 {
+		return nil, errors
+	}
+
+	pr := newPrinter(scan(filename, string(src)))
+	pr.program(program)
+
+	return pr.bytes(), nil
+}
+
+// Node formats a program, a statement or an expression
+// The tree has no comments, so none are printed
+func Node(node ast.Node) string {
+	pr := newPrinter(nil)
+
+	switch node := node.(type) {
+	case *ast.Program:
+		pr.program(node)
+		return string(pr.bytes())
+	case ast.Statement:
+		pr.statement(node)
+		if needsSemicolon(node, nil) {
+			pr.write(";")
+		}
+	case ast.Expression:
+		pr.expression(node)
+	}
+
+	return pr.buf.String()
+}
+
+// scan returns every token of the source, including the comments
+func scan(filename, src string) []token.Token {
+	l := lexer.NewFile(filename, src)
+	l.SetMode(lexer.ScanComments)
+
+	var tokens []token.Token
+	for tkn := l.NextToken(); tkn.Type != token.EOF; tkn = l.NextToken() {
+		tokens = append(tokens, tkn)
+	}
+
+	return tokens
+}
+
+// endLine returns the line of the last character of a token
+// Strings and block comments can span multiple lines
+func endLine(tkn token.Token) int {
+	return tkn.Pos.Line + strings.Count(tkn.Literal, "\n")
+}
+
+// source holds the tokens of the formatted source, which are used to
+//  place the comments and the blank lines
+type source struct {
+	tokens   []token.Token
+	comments []token.Token
+
+	// Closing braces by the offset of their opening brace
+	rbraces map[int]token.Token
+}
+
+// newSource indexes the tokens of the source
+func newSource(tokens []token.Token) source {
+	s := source{tokens: tokens, rbraces: map[int]token.Token{}}
+
+	var open []int
+	for _, tkn := range tokens {
+		switch tkn.Type {
+		case token.COMMENT:
+			s.comments = append(s.comments, tkn)
+		case token.LBRACE:
+			open = append(open, tkn.Pos.Offset)
+		case token.RBRACE:
+			if len(open) > 0 {
+				s.rbraces[open[len(open)-1]] = tkn
+				open = open[:len(open)-1]
+			}
+		}
+	}
+
+	return s
+}
+
+// before returns the index of the last token that starts before an
+//  offset, or -1
+func (s source) before(offset int) int {
+	return sort.Search(len(s.tokens), func(i int) bool {
+		return s.tokens[i].Pos.Offset >= offset
+	}) - 1
+}
+
+// blankLine checks if there is an empty line before the token at an
+//  offset
+func (s source) blankLine(pos token.Position) bool {
+	i := s.before(pos.Offset)
+	if i < 0 {
+		return false
+	}
+
+	return pos.Line-endLine(s.tokens[i]) > 1
+}
+
+// trailing checks if a comment starts on the line where the token
+//  before it ends
+func (s source) trailing(comment token.Token) bool {
+	i := s.before(comment.Pos.Offset)
+	if i < 0 {
+		return false
+	}
+
+	return endLine(s.tokens[i]) == comment.Pos.Line
+}
@@ -0,0 +1,159 @@
+package format
+
+import (
+	"testing"
+
+	"github.com/shavit/go-interpreter/ast"
+	"github.com/shavit/go-interpreter/diagnostic"
+	"github.com/shavit/go-interpreter/lexer"
+	"github.com/shavit/go-interpreter/parser"
+	"github.com/shavit/go-interpreter/token"
+)
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"", ""},
+		{"let x=5", "let x = 5;\n"},
+		{"return", "return;\n"},
+		{"return ( x )", "return x;\n"},
+		{"((a + b) * c)", "(a + b) * c;\n"},
+		{"a + (b * c)", "a + b * c;\n"},
+		{"(a - b) - c; a - (b - c)", "a - b - c;\na - (b - c);\n"},
+		{"-(a + b); -(-a); !(a == b)", "-(a + b);\n--a;\n!(a == b);\n"},
+		{"(a < b) == (c > d)", "a < b == c > d;\n"},
+		{"(a && b) || (c && d); a && (b || c); (a || b) || c; a || (b || c)", "a && b || c && d;\na && (b || c);\na || b || c;\na || (b || c);\n"},
+		{"(x == 1) && !(y); (a && b) == c", "x == 1 && !y;\n(a && b) == c;\n"},
+		{"(-f)(x); f(x)(y); (a + b)(c)", "(-f)(x);\nf(x)(y);\n(a + b)(c);\n"},
+		{`puts("a\n"  ,  "\u{e9}")`, "puts(\"a\\n\", \"\\u{e9}\");\n"},
+		{"let add = fn(x,y){x+y};", "let add = fn(x, y) {\n\tx + y;\n};\n"},
+		{"fn(){}", "fn() {}\n"},
+		{"[ 1,2 , [] ][ (0) ]; (a + b)[0]; (-a)[0]; a[0][1]", "[1, 2, []][0];\n(a + b)[0];\n(-a)[0];\na[0][1];\n"},
+		{`let m={ "a":1,2 :[ ] , true:{} }; {}["a"]`, "let m = {\"a\": 1, 2: [], true: {}};\n{}[\"a\"];\n"},
+		{"if (x) { 1 }; [1]; if (x) { 1 }; (a)[0]", "if (x) {\n\t1;\n};\n[1];\nif (x) {\n\t1;\n}\na[0];\n"},
+		{"if (x) { if (y) { 1 } else { 2 } }", "if (x) {\n\tif (y) {\n\t\t1;\n\t} else {\n\t\t2;\n\t}\n}\n"},
+		{"if (x) { 1 }; let y = 2", "if (x) {\n\t1;\n}\nlet y = 2;\n"},
+		{"if (x) { 1 }; -y; if (x) { 1 }; (y)", "if (x) {\n\t1;\n};\n-y;\nif (x) {\n\t1;\n}\ny;\n"},
+		{"if (x) { 1 }; (a + b) * c", "if (x) {\n\t1;\n};\n(a + b) * c;\n"},
+		{"let x = 1;\n\n\n\nlet y = 2", "let x = 1;\n\nlet y = 2;\n"},
+		{"\n\nlet x = 1;\n\n", "let x = 1;\n"},
+	}
+
+	for _, tt := range tests {
+		testSource(t, tt.input, tt.expected)
+	}
+}
+
+func TestSourceComments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"// only a comment", "// only a comment\n"},
+		{"// add\nlet x = 1 // one\n// end", "// add\nlet x = 1; // one\n// end\n"},
+		{"let x = 1; /* a */ /* b */\n\n// c\nx", "let x = 1; /* a */ /* b */\n\n// c\nx;\n"},
+		{"1 + /* two */ 2", "1 + /* two */ 2;\n"},
+		{"1 /* one */ + 2", "1 /* one */ + 2;\n"},
+		{"1 + // two\n2", "1 + // two\n\t2;\n"},
+		{"fn() { // empty\n}", "fn() { // empty\n}\n"},
+		{"fn() {\n// empty\n}", "fn() {\n\t// empty\n}\n"},
+		{"if (x) {\n1 // one\n\n// after\n} // if", "if (x) {\n\t1; // one\n\n\t// after\n} // if\n"},
+		{"let f = fn() {\n  /* a\n  b */\n  1\n}", "let f = fn() {\n\t/* a\n  b */\n\t1;\n};\n"},
+	}
+
+	for _, tt := range tests {
+		testSource(t, tt.input, tt.expected)
+	}
+}
+
+func TestSourceErrors(t *testing.T) {
+	out, errors := Source("test.mk", []byte("let = 5;"))
+	if out != nil {
+		t.Errorf("Found %q, while expecting no output", out)
+	}
+
+	if len(errors) == 0 || errors[0].Code != diagnostic.ErrUnexpectedToken {
+		t.Errorf("Found %v, while expecting %s", errors, diagnostic.ErrUnexpectedToken)
+	}
+}
+
+func TestNode(t *testing.T) {
+	exp := &ast.InfixExpression{
+		Operator: "*",
+		Left: &ast.InfixExpression{
+			Operator: "+",
+			Left:     &ast.IntegerLiteral{Value: 1},
+			Right:    &ast.StringLiteral{Value: "a\tb"},
+		},
+		Right: &ast.Identifier{Value: "x"},
+	}
+
+	tests := []struct {
+		node     ast.Node
+		expected string
+	}{
+		{exp, `(1 + "a\tb") * x`},
+		{&ast.ExpressionStatement{Expression: exp}, `(1 + "a\tb") * x;`},
+		{&ast.LetStatement{Name: &ast.Identifier{Value: "y"}, Value: &ast.BooleanLiteral{Value: true}}, "let y = true;"},
+		{&ast.Program{Statements: []ast.Statement{&ast.ReturnStatement{}}}, "return;\n"},
+		{&ast.FloatLiteral{Value: 2}, "2.0"},
+		{&ast.IndexExpression{Left: &ast.ArrayLiteral{Elements: []ast.Expression{exp}}, Index: &ast.IntegerLiteral{Value: 0}}, `[(1 + "a\tb") * x][0]`},
+	}
+
+	for _, tt := range tests {
+		if out := Node(tt.node); out != tt.expected {
+			t.Errorf("Found %q, while expecting %q", out, tt.expected)
+		}
+	}
+}
+
+// testSource checks the formatted source, that formatting it again does
+//  not change it, and that it parses to the same program
+func testSource(t *testing.T, input, expected string) {
+	t.Helper()
+
+	out, errors := Source("test.mk", []byte(input))
+	if len(errors) > 0 {
+		t.Fatalf("Found errors %v for %q", errors, input)
+	}
+
+	if string(out) != expected {
+		t.Errorf("Found %q, while expecting %q", out, expected)
+	}
+
+	again, errors := Source("test.mk", out)
+	if len(errors) > 0 || string(again) != string(out) {
+		t.Errorf("Found %q (%v) after formatting again, while expecting %q", again, errors, out)
+	}
+
+	if parse(t, string(out)) != parse(t, input) {
+		t.Errorf("Found %q, while expecting %q", parse(t, string(out)), parse(t, input))
+	}
+
+	if count(t, string(out)) != count(t, input) {
+		t.Errorf("Found %d comments, while expecting %d in %q", count(t, string(out)), count(t, input), out)
+	}
+}
+
+func parse(t *testing.T, input string) string {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		t.Fatalf("Found errors %v for %q", p.Errors(), input)
+	}
+
+	return program.String()
+}
+
+func count(t *testing.T, input string) int {
+	comments := 0
+	for _, tkn := range scan("", input) {
+		if tkn.Type == token.COMMENT {
+			comments += 1
+		}
+	}
+
+	return comments
+}
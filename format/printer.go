@@ -0,0 +1,431 @@
+package format
+
+import (
+	"bytes"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/shavit/go-interpreter/ast"
+	"github.com/shavit/go-interpreter/lexer"
+	"github.com/shavit/go-interpreter/parser"
+	"github.com/shavit/go-interpreter/token"
+)
+
+// Precedence of literals, identifiers and other expressions that never
+//  need parentheses
+const highest = math.MaxInt32
+
+// printer writes the nodes in the canonical style
+// The nodes are printed in the order of the source, so the comments are
+//  printed before the first token that follows them
+type printer struct {
+	buf    bytes.Buffer
+	indent int
+
+	src  source
+	next int // Index of the next comment to print
+
+	// Nothing was printed since the start of the program or the block,
+	//  so no blank line is needed
+	open bool
+}
+
+// newPrinter creates a printer for the tokens of the source, which are
+//  empty for trees without a source
+func newPrinter(tokens []token.Token) *printer {
+	return &printer{src: newSource(tokens), open: true}
+}
+
+// bytes returns the printed source
+func (p *printer) bytes() []byte {
+	return p.buf.Bytes()
+}
+
+// atLineStart checks if nothing was printed on the current line
+func (p *printer) atLineStart() bool {
+	b := p.buf.Bytes()
+	return len(b) == 0 || b[len(b)-1] == '\n'
+}
+
+// write prints text, and indents it at the start of a line
+func (p *printer) write(s string) {
+	if p.atLineStart() {
+		p.buf.WriteString(strings.Repeat("\t", p.indent))
+	}
+	p.buf.WriteString(s)
+}
+
+// newline ends the current line
+func (p *printer) newline() {
+	p.buf.WriteByte('\n')
+}
+
+// blankLine keeps a single empty line, where the source has one or more
+func (p *printer) blankLine(pos token.Position) {
+	if !p.open && p.src.blankLine(pos) {
+		p.newline()
+	}
+	p.open = false
+}
+
+// token prints the text of a token, after the comments before it
+func (p *printer) token(tkn token.Token, text string) {
+	p.flush(tkn.Pos.Offset)
+	p.write(text)
+}
+
+// hasComments checks if there are comments before an offset
+func (p *printer) hasComments(offset int) bool {
+	return p.next < len(p.src.comments) && p.src.comments[p.next].Pos.Offset < offset
+}
+
+// flush prints the comments that start before an offset
+func (p *printer) flush(offset int) {
+	for p.hasComments(offset) {
+		p.comment(p.src.comments[p.next])
+		p.next += 1
+	}
+}
+
+// comment prints a comment on its own line, or inside an expression
+func (p *printer) comment(c token.Token) {
+	if p.atLineStart() {
+		p.blankLine(c.Pos)
+		p.write(c.Literal)
+		p.newline()
+		return
+	}
+
+	if b := p.buf.Bytes(); b[len(b)-1] != ' ' {
+		p.buf.WriteByte(' ')
+	}
+	p.buf.WriteString(c.Literal)
+
+	// The rest of the expression continues on the next line, after a
+	//  line comment
+	if strings.HasPrefix(c.Literal, "//") {
+		p.newline()
+		p.buf.WriteString(strings.Repeat("\t", p.indent+1))
+	} else {
+		p.buf.WriteByte(' ')
+	}
+}
+
+// trailing prints the comments on the line where a statement ends, and
+//  before an offset
+func (p *printer) trailing(offset int) {
+	for p.hasComments(offset) {
+		c := p.src.comments[p.next]
+		if !p.src.trailing(c) {
+			return
+		}
+
+		p.write(" " + c.Literal)
+		p.next += 1
+	}
+}
+
+// program prints the statements of the program, and the comments
+//  after them
+func (p *printer) program(program *ast.Program) {
+	p.statements(program.Statements, math.MaxInt)
+	p.flush(math.MaxInt)
+}
+
+// statements prints a list of statements that ends before an offset,
+//  one statement per line
+func (p *printer) statements(list []ast.Statement, end int) {
+	for i, stmt := range list {
+		var next ast.Statement
+		nextOffset := end
+		if i+1 < len(list) {
+			next = list[i+1]
+			nextOffset = statementPos(next).Offset
+		}
+
+		pos := statementPos(stmt)
+		p.flush(pos.Offset)
+		p.blankLine(pos)
+
+		p.statement(stmt)
+		if needsSemicolon(stmt, next) {
+			p.write(";")
+		}
+
+		p.trailing(nextOffset)
+		p.newline()
+	}
+}
+
+// statement prints a statement without the semicolon
+func (p *printer) statement(stmt ast.Statement) {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		p.token(stmt.Token, "let ")
+		p.token(stmt.Name.Token, stmt.Name.Value)
+		p.write(" = ")
+		p.expression(stmt.Value)
+	case *ast.ReturnStatement:
+		p.token(stmt.Token, "return")
+		if stmt.ReturnValue != nil {
+			p.write(" ")
+			p.expression(stmt.ReturnValue)
+		}
+	case *ast.ExpressionStatement:
+		p.expression(stmt.Expression)
+	case *ast.BlockStatement:
+		p.block(stmt)
+	case *ast.BadStatement:
+		p.token(stmt.Token, stmt.String())
+	}
+}
+
+// block prints the statements between braces, indented by a tab
+// Blocks without statements and comments are printed as {}
+func (p *printer) block(block *ast.BlockStatement) {
+	p.token(block.Token, "{")
+
+	end := math.MaxInt
+	if rbrace, ok := p.src.rbraces[block.Token.Pos.Offset]; ok {
+		end = rbrace.Pos.Offset
+	}
+
+	if len(block.Statements) == 0 && !p.hasComments(end) {
+		p.write("}")
+		return
+	}
+
+	if len(block.Statements) > 0 {
+		p.trailing(statementPos(block.Statements[0]).Offset)
+	} else {
+		p.trailing(end)
+	}
+	p.newline()
+
+	p.indent += 1
+	p.open = true
+	p.statements(block.Statements, end)
+	p.flush(end)
+	p.indent -= 1
+
+	p.write("}")
+}
+
+// expression prints an expression, and the parentheses its operands
+//  need
+func (p *printer) expression(exp ast.Expression) {
+	switch exp := exp.(type) {
+	case *ast.Identifier:
+		p.token(exp.Token, exp.Value)
+	case *ast.IntegerLiteral:
+		literal := exp.Token.Literal
+		if literal == "" {
+			literal = strconv.FormatInt(exp.Value, 10)
+		}
+		p.token(exp.Token, literal)
+	case *ast.FloatLiteral:
+		literal := exp.Token.Literal
+		if literal == "" {
+			literal = token.FormatFloat(exp.Value)
+		}
+		p.token(exp.Token, literal)
+	case *ast.StringLiteral:
+		literal := exp.Token.Literal
+		if literal == "" {
+			literal = lexer.Quote(exp.Value)
+		}
+		p.token(exp.Token, literal)
+	case *ast.BooleanLiteral:
+		p.token(exp.Token, strconv.FormatBool(exp.Value))
+	case *ast.PrefixExpression:
+		p.token(exp.Token, exp.Operator)
+		p.operand(exp.Right, precedence(exp.Right) < parser.PREFIX)
+	case *ast.InfixExpression:
+		prec := operatorPrecedence(exp.Operator)
+		p.operand(exp.Left, precedence(exp.Left) < prec)
+		p.write(" ")
+		p.token(exp.Token, exp.Operator)
+		p.write(" ")
+		p.operand(exp.Right, precedence(exp.Right) <= prec)
+	case *ast.LogicalExpression:
+		prec := operatorPrecedence(exp.Operator)
+		p.operand(exp.Left, precedence(exp.Left) < prec)
+		p.write(" ")
+		p.token(exp.Token, exp.Operator)
+		p.write(" ")
+		p.operand(exp.Right, precedence(exp.Right) <= prec)
+	case *ast.IfExpression:
+		p.token(exp.Token, "if")
+		p.write(" (")
+		p.expression(exp.Condition)
+		p.write(") ")
+		p.block(exp.Consequence)
+		if exp.Alternative != nil {
+			p.write(" else ")
+			p.block(exp.Alternative)
+		}
+	case *ast.FunctionLiteral:
+		p.token(exp.Token, "fn")
+		p.write("(")
+		for i, param := range exp.Parameters {
+			if i > 0 {
+				p.write(", ")
+			}
+			p.token(param.Token, param.Value)
+		}
+		p.write(") ")
+		p.block(exp.Body)
+	case *ast.CallExpression:
+		p.operand(exp.Function, precedence(exp.Function) < parser.CALL)
+		p.token(exp.Token, "(")
+		for i, arg := range exp.Arguments {
+			if i > 0 {
+				p.write(", ")
+			}
+			p.expression(arg)
+		}
+		p.write(")")
+	case *ast.ArrayLiteral:
+		p.token(exp.Token, "[")
+		for i, el := range exp.Elements {
+			if i > 0 {
+				p.write(", ")
+			}
+			p.expression(el)
+		}
+		p.write("]")
+	case *ast.HashLiteral:
+		p.token(exp.Token, "{")
+		for i, pair := range exp.Pairs {
+			if i > 0 {
+				p.write(", ")
+			}
+			p.expression(pair.Key)
+			p.write(": ")
+			p.expression(pair.Value)
+		}
+		p.write("}")
+	case *ast.IndexExpression:
+		p.operand(exp.Left, precedence(exp.Left) < parser.INDEX)
+		p.token(exp.Token, "[")
+		p.expression(exp.Index)
+		p.write("]")
+	case *ast.BadExpression:
+		p.token(exp.Token, exp.String())
+	}
+}
+
+// operand prints an expression between parentheses when needed
+func (p *printer) operand(exp ast.Expression, parens bool) {
+	if !parens {
+		p.expression(exp)
+		return
+	}
+
+	p.write("(")
+	p.expression(exp)
+	p.write(")")
+}
+
+// precedence returns the precedence of the operator of an expression
+func precedence(exp ast.Expression) int {
+	switch exp := exp.(type) {
+	case *ast.InfixExpression:
+		return operatorPrecedence(exp.Operator)
+	case *ast.LogicalExpression:
+		return operatorPrecedence(exp.Operator)
+	case *ast.PrefixExpression:
+		return parser.PREFIX
+	case *ast.CallExpression:
+		return parser.CALL
+	case *ast.IndexExpression:
+		return parser.INDEX
+	default:
+		return highest
+	}
+}
+
+// operatorPrecedence returns the precedence of an infix or logical
+//  operator
+// The types of the operator tokens are their literals
+func operatorPrecedence(operator string) int {
+	return parser.Precedence(token.TokenType(operator))
+}
+
+// statementPos returns the position of the first token of a statement
+func statementPos(stmt ast.Statement) token.Position {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		return stmt.Token.Pos
+	case *ast.ReturnStatement:
+		return stmt.Token.Pos
+	case *ast.ExpressionStatement:
+		return stmt.Token.Pos
+	case *ast.BlockStatement:
+		return stmt.Token.Pos
+	case *ast.BadStatement:
+		return stmt.Token.Pos
+	default:
+		return token.Position{}
+	}
+}
+
+// needsSemicolon checks if a statement ends with a semicolon
+// Only expression statements that end with a block, like if
+//  expressions, are printed without it, unless the next statement
+//  would continue their expression
+func needsSemicolon(stmt, next ast.Statement) bool {
+	switch stmt := stmt.(type) {
+	case *ast.BlockStatement, *ast.BadStatement:
+		return false
+	case *ast.ExpressionStatement:
+		if !endsWithBlock(stmt.Expression) {
+			return true
+		}
+	default:
+		return true
+	}
+
+	es, ok := next.(*ast.ExpressionStatement)
+	return ok && continues(es.Expression)
+}
+
+// endsWithBlock checks if the last printed token of an expression is a
+//  closing brace
+func endsWithBlock(exp ast.Expression) bool {
+	switch exp := exp.(type) {
+	case *ast.IfExpression, *ast.FunctionLiteral:
+		return true
+	case *ast.PrefixExpression:
+		return precedence(exp.Right) >= parser.PREFIX && endsWithBlock(exp.Right)
+	case *ast.InfixExpression:
+		return precedence(exp.Right) > operatorPrecedence(exp.Operator) && endsWithBlock(exp.Right)
+	case *ast.LogicalExpression:
+		return precedence(exp.Right) > operatorPrecedence(exp.Operator) && endsWithBlock(exp.Right)
+	default:
+		return false
+	}
+}
+
+// continues checks if the first printed token of an expression is also
+//  an infix operator, like -, ( or [
+// Without a semicolon, it would continue the expression before it
+func continues(exp ast.Expression) bool {
+	switch exp := exp.(type) {
+	case *ast.PrefixExpression:
+		return parser.Precedence(token.TokenType(exp.Operator)) > parser.LOWEST
+	case *ast.InfixExpression:
+		return precedence(exp.Left) < operatorPrecedence(exp.Operator) || continues(exp.Left)
+	case *ast.LogicalExpression:
+		return precedence(exp.Left) < operatorPrecedence(exp.Operator) || continues(exp.Left)
+	case *ast.CallExpression:
+		return precedence(exp.Function) < parser.CALL || continues(exp.Function)
+	case *ast.ArrayLiteral:
+		return true
+	case *ast.IndexExpression:
+		return precedence(exp.Left) < parser.INDEX || continues(exp.Left)
+	default:
+		return false
+	}
+}
@@ -0,0 +1,74 @@
+package lexer
+
+import (
+	"github.com/shavit/go-interpreter/diagnostic"
+	"github.com/shavit/go-interpreter/token"
+)
+
+// atComment checks if a comment starts at the current character
+func (l *Lexer) atComment() bool {
+	return l.ch == '/' && (l.peekChar() == '/' || l.peekChar() == '*')
+}
+
+// readComment reads a line or a block comment, including the delimiters
+// Line comments stop before the new line character
+// Skipped comments are not recorded, so a large comment is not held in
+//  memory, and their tokens only have the opening delimiter
+func (l *Lexer) readComment() token.Token {
+	pos := l.currentPosition()
+	if l.mode != SkipComments {
+		l.startLiteral()
+	}
+
+	// Skip the first slash, and check the type of the comment
+	l.readChar()
+
+	if l.ch == '/' {
+		for l.ch != '\n' && l.ch != 0 {
+			l.readChar()
+		}
+
+		return token.Token{Type: token.COMMENT, Literal: l.commentLiteral("//"), Pos: pos}
+	}
+
+	if !l.skipBlockComment() {
+		l.addError(diagnostic.ErrUnterminatedComment, pos, "Unterminated block comment")
+		return token.Token{Type: token.ILLEGAL, Literal: l.commentLiteral("/*"), Pos: pos}
+	}
+
+	return token.Token{Type: token.COMMENT, Literal: l.commentLiteral("/*"), Pos: pos}
+}
+
+// commentLiteral returns the comment that was read, or its opening
+//  delimiter when comments are skipped
+func (l *Lexer) commentLiteral(delimiter string) string {
+	if l.mode == SkipComments {
+		return delimiter
+	}
+
+	return l.endLiteral()
+}
+
+// skipBlockComment reads until the end of a block comment, that starts
+//  at the asterisk
+// Block comments can be nested, so every /* needs a matching */
+func (l *Lexer) skipBlockComment() bool {
+	depth := 1
+	l.readChar()
+
+	for depth > 0 {
+		switch {
+		case l.ch == 0:
+			return false
+		case l.ch == '/' && l.peekChar() == '*':
+			depth += 1
+			l.readChar()
+		case l.ch == '*' && l.peekChar() == '/':
+			depth -= 1
+			l.readChar()
+		}
+		l.readChar()
+	}
+
+	return true
+}
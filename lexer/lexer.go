@@ -1,54 +1,294 @@
 package lexer
 
 import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/shavit/go-interpreter/diagnostic"
 	"github.com/shavit/go-interpreter/token"
 )
 
+// Lexer reads tokens from a buffered reader, so the input does not
+//  have to be loaded into memory
 type Lexer struct {
-	input        string
-	position     int  // Current character position (ch)
-	readPosition int  // After current character
-	ch           byte // Current character (in position)
+	reader   *bufio.Reader
+	position int    // Current character position (ch)
+	ch       rune   // Current character (in position)
+	raw      []byte // Encoded bytes of the current character
+	eof      bool   // Reached the end of the input
+
+	// The characters of the token being read
+	literal   strings.Builder
+	recording bool
+
+	filename string
+	line     int // Line of the current character
+	column   int // Column of the current character, in runes
+
+	mode   Mode
+	errors []diagnostic.Diagnostic
 }
 
+// Mode controls what the lexer does with comments
+type Mode int
+
+const (
+	// SkipComments ignores comments like white space
+	SkipComments Mode = iota
+
+	// ScanComments returns comments as COMMENT tokens
+	ScanComments
+
+	// AttachComments adds comments to the leading trivia of the token
+	//  that follows them
+	AttachComments
+)
+
 // New creates a new Lexer
 func New(input string) *Lexer {
+	return NewFile("", input)
+}
+
+// NewFile creates a new Lexer for the content of a file
+// The filename is added to the position of every token
+func NewFile(filename, input string) *Lexer {
+	return NewReader(filename, strings.NewReader(input))
+}
+
+// NewReader creates a new Lexer that reads the input incrementally
+// Only a small buffer and the current token are kept in memory
+func NewReader(name string, r io.Reader) *Lexer {
 	l := &Lexer{
-		input: input,
+		reader:   bufio.NewReader(r),
+		filename: name,
+		line:     1,
 	}
 	l.readChar()
 
 	return l
 }
 
-// readChar reads the next character
+// readChar decodes the next UTF-8 character
 func (l *Lexer) readChar() {
-	// Advance by 1 or assign NUL at the end
-	if l.readPosition >= len(l.input) {
+	// Stay at the end of the input
+	if l.eof {
+		return
+	}
+
+	if l.recording {
+		l.literal.Write(l.raw)
+	}
+
+	// Move to the next line after a new line character
+	if l.ch == '\n' {
+		l.line += 1
+		l.column = 0
+	}
+
+	l.position += len(l.raw)
+	l.column += 1
+
+	ch, buf, err := l.peekRune()
+	if len(buf) == 0 {
+		if err != nil && err != io.EOF {
+			l.readError(err)
+		}
+
+		// Assign NUL at the end
 		l.ch = 0x0
-	} else {
-		l.ch = l.input[l.readPosition]
+		l.raw = l.raw[:0]
+		l.eof = true
+		return
+	}
+
+	l.ch = ch
+	l.raw = append(l.raw[:0], buf...)
+	l.reader.Discard(len(buf))
+
+	if ch == utf8.RuneError && len(buf) == 1 {
+		l.invalidEncodingError()
+	}
+}
+
+// peekRune decodes the next character without consuming it
+// It returns the bytes of the character, which are empty at the end of
+//  the input
+func (l *Lexer) peekRune() (rune, []byte, error) {
+	buf, err := l.reader.Peek(1)
+	if len(buf) == 0 {
+		return 0, nil, err
+	}
+
+	// Only wait for the bytes of this character, so interactive inputs
+	//  are not blocked
+	if n := encodedLength(buf[0]); n > 1 {
+		buf, _ = l.reader.Peek(n)
+	}
+
+	ch, width := utf8.DecodeRune(buf)
+
+	return ch, buf[:width], nil
+}
+
+// encodedLength returns the length of a UTF-8 character from its first
+//  byte
+func encodedLength(b byte) int {
+	switch {
+	case b&0xE0 == 0xC0:
+		return 2
+	case b&0xF0 == 0xE0:
+		return 3
+	case b&0xF8 == 0xF0:
+		return 4
+	default:
+		return 1
+	}
+}
+
+// startLiteral starts recording the characters of a token, from the
+//  current character
+func (l *Lexer) startLiteral() {
+	l.literal.Reset()
+	l.recording = true
+}
+
+// recorded returns the characters recorded so far, without the current
+//  character
+func (l *Lexer) recorded() string {
+	return l.literal.String()
+}
+
+// endLiteral stops recording, and returns the characters before the
+//  current character
+func (l *Lexer) endLiteral() string {
+	l.recording = false
+	return l.literal.String()
+}
+
+// readError adds an error for a reader that failed
+// The lexer stops as if it reached the end of the input
+func (l *Lexer) readError(err error) {
+	l.errors = append(l.errors, diagnostic.Diagnostic{
+		Severity: diagnostic.Error,
+		Code:     diagnostic.ErrRead,
+		Message:  fmt.Sprintf("Could not read the input: %v", err),
+		Start:    l.currentPosition(),
+		End:      l.currentPosition(),
+		Found:    token.EOF,
+	})
+}
+
+// invalidEncodingError adds an error for the invalid byte at the
+//  current position
+func (l *Lexer) invalidEncodingError() {
+	start := l.currentPosition()
+	end := start
+	end.Offset += 1
+	end.Column += 1
+
+	l.errors = append(l.errors, diagnostic.Diagnostic{
+		Severity: diagnostic.Error,
+		Code:     diagnostic.ErrInvalidUTF8,
+		Message:  fmt.Sprintf("Invalid UTF-8 encoding %q", l.raw),
+		Start:    start,
+		End:      end,
+		Found:    token.ILLEGAL,
+	})
+}
+
+// isInvalidEncoding checks if the current character could not be decoded
+func (l *Lexer) isInvalidEncoding() bool {
+	return l.ch == utf8.RuneError && len(l.raw) == 1
+}
+
+// currentPosition returns the position of the current character
+func (l *Lexer) currentPosition() token.Position {
+	return token.Position{
+		Filename: l.filename,
+		Offset:   l.position,
+		Line:     l.line,
+		Column:   l.column,
 	}
+}
+
+// SetMode changes how the lexer handles comments
+// The default mode skips comments
+func (l *Lexer) SetMode(mode Mode) {
+	l.mode = mode
+}
 
-	// Move to the next byte
-	l.position = l.readPosition
-	l.readPosition += 1
+// Errors returns the lexer errors
+// Tokens with errors are returned as ILLEGAL tokens
+func (l *Lexer) Errors() []diagnostic.Diagnostic {
+	return l.errors
+}
+
+// addError adds an error diagnostic from a position to the current
+//  character
+func (l *Lexer) addError(code diagnostic.Code, start token.Position, msg string) {
+	l.errors = append(l.errors, diagnostic.Diagnostic{
+		Severity: diagnostic.Error,
+		Code:     code,
+		Message:  msg,
+		Start:    start,
+		End:      l.currentPosition(),
+		Found:    token.ILLEGAL,
+	})
 }
 
 // peekChar reads a character without incrementing the position
 // It is being use to peek the next character
-func (l *Lexer) peekChar() byte {
-	if l.readPosition >= len(l.input) {
+func (l *Lexer) peekChar() rune {
+	if l.eof {
 		return 0
-	} else {
-		return l.input[l.readPosition]
 	}
+
+	ch, _, _ := l.peekRune()
+
+	return ch
 }
 
 // NextToken gets the next token
+// Comments are skipped, returned or attached to the next token,
+//  depending on the mode of the lexer
 func (l *Lexer) NextToken() token.Token {
+	var leading []token.Token
+
+	for {
+		l.ignoreWhitespace()
+		if !l.atComment() {
+			break
+		}
+
+		comment := l.readComment()
+		if comment.Type == token.ILLEGAL {
+			return comment
+		}
+
+		switch l.mode {
+		case ScanComments:
+			return comment
+		case AttachComments:
+			leading = append(leading, comment)
+		}
+	}
+
+	tkn := l.readToken()
+	tkn.Leading = leading
+
+	return tkn
+}
+
+// readToken reads the token that starts at the current character
+func (l *Lexer) readToken() token.Token {
 	var tkn token.Token
-	l.ignoreWhitespace()
+
+	// Every token starts at the current character
+	pos := l.currentPosition()
 
 	switch l.ch {
 	case '=':
@@ -71,6 +311,20 @@ func (l *Lexer) NextToken() token.Token {
 		} else {
 			tkn = newToken(token.BANG, l.ch)
 		}
+	case '&':
+		if l.peekChar() != '&' {
+			return l.illegalCharacter(pos)
+		}
+		ch := l.ch
+		l.readChar()
+		tkn = token.Token{Type: token.AND, Literal: string(ch) + string(l.ch)}
+	case '|':
+		if l.peekChar() != '|' {
+			return l.illegalCharacter(pos)
+		}
+		ch := l.ch
+		l.readChar()
+		tkn = token.Token{Type: token.OR, Literal: string(ch) + string(l.ch)}
 	case '/':
 		tkn = newToken(token.SLASH, l.ch)
 	case '*':
@@ -87,10 +341,23 @@ func (l *Lexer) NextToken() token.Token {
 		tkn = newToken(token.RPAREN, l.ch)
 	case ',':
 		tkn = newToken(token.COMMA, l.ch)
+	case ':':
+		tkn = newToken(token.COLON, l.ch)
+	case '[':
+		tkn = newToken(token.LBRACKET, l.ch)
+	case ']':
+		tkn = newToken(token.RBRACKET, l.ch)
 	case '{':
 		tkn = newToken(token.LBRACE, l.ch)
 	case '}':
 		tkn = newToken(token.RBRACE, l.ch)
+	case '"':
+		literal, ok := l.readString()
+		tkn = token.Token{Type: token.STRING, Literal: literal, Pos: pos}
+		if !ok {
+			tkn.Type = token.ILLEGAL
+		}
+		return tkn
 	case 0x0:
 		tkn.Literal = ""
 		tkn.Type = token.EOF
@@ -98,23 +365,41 @@ func (l *Lexer) NextToken() token.Token {
 		if isLetter(l.ch) {
 			tkn.Literal = l.readIdentifier()
 			tkn.Type = token.LookupIdent(tkn.Literal)
+			tkn.Pos = pos
+			return tkn
+		} else if isDigit(l.ch) || l.ch == '.' && isDigit(l.peekChar()) {
+			tkn.Type, tkn.Literal = l.readNumber()
+			tkn.Pos = pos
 			return tkn
-		} else if isDigit(l.ch) {
-			tkn.Type = token.INT
-			tkn.Literal = l.readNumber()
+		} else if l.isInvalidEncoding() {
+			// The error was added when the character was read
+			tkn = token.Token{Type: token.ILLEGAL, Literal: string(l.raw), Pos: pos}
+			l.readChar()
 			return tkn
 		} else {
-			tkn = newToken(token.ILLEGAL, l.ch)
+			return l.illegalCharacter(pos)
 		}
 	}
 
 	l.readChar()
+	tkn.Pos = pos
+
+	return tkn
+}
+
+// illegalCharacter returns the current character as an ILLEGAL token,
+//  and adds an error for it
+func (l *Lexer) illegalCharacter(pos token.Position) token.Token {
+	tkn := newToken(token.ILLEGAL, l.ch)
+	l.readChar()
+	l.addError(diagnostic.ErrIllegalCharacter, pos, fmt.Sprintf("Unexpected character %q", tkn.Literal))
+	tkn.Pos = pos
 
 	return tkn
 }
 
 // newToken creates a new token
-func newToken(tokenType token.TokenType, ch byte) token.Token {
+func newToken(tokenType token.TokenType, ch rune) token.Token {
 	return token.Token{
 		Type:    tokenType,
 		Literal: string(ch),
@@ -129,34 +414,78 @@ func (l *Lexer) ignoreWhitespace() {
 }
 
 // readIdentifier reads an identifier
+// Identifiers start with a letter, and can contain letters and digits
 func (l *Lexer) readIdentifier() string {
-	position := l.position
-	for isLetter(l.ch) {
+	l.startLiteral()
+	for isLetter(l.ch) || unicode.IsDigit(l.ch) {
 		l.readChar()
 	}
 
-	return l.input[position:l.position]
+	return l.endLiteral()
 }
 
-// isLetter checks if the current byte is a letter
-// it checks if the byte in the range of [a-zA-Z_]
-func isLetter(ch byte) bool {
-	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_'
+// isLetter checks if the current character is a letter
+// it checks if the character is a Unicode letter or _
+func isLetter(ch rune) bool {
+	return unicode.IsLetter(ch) || ch == '_'
 }
 
-// readNumber reads a number
-// It only supports integers
-func (l *Lexer) readNumber() string {
-	position := l.position
-	for isDigit(l.ch) {
+// readNumber reads an integer or a float
+// Floats have a fraction, like 3.14 or .5, or an exponent, like 1e-9
+// An exponent without digits is returned as an ILLEGAL token
+func (l *Lexer) readNumber() (token.TokenType, string) {
+	start := l.currentPosition()
+	l.startLiteral()
+
+	var tokenType token.TokenType = token.INT
+	l.readDigits()
+
+	if l.ch == '.' && isDigit(l.peekChar()) {
+		tokenType = token.FLOAT
+		l.readChar()
+		l.readDigits()
+	}
+
+	if l.ch == 'e' || l.ch == 'E' {
+		tokenType = token.FLOAT
 		l.readChar()
+		if l.ch == '+' || l.ch == '-' {
+			l.readChar()
+		}
+
+		if !isDigit(l.ch) {
+			literal := l.endLiteral()
+			l.addError(diagnostic.ErrMalformedNumber, start, fmt.Sprintf("The exponent of %q has no digits", literal))
+			return token.ILLEGAL, literal
+		}
+		l.readDigits()
 	}
 
-	return l.input[position:l.position]
+	// Another fraction right after the number, for example `1.2.3`,
+	//  would otherwise be read as the float `.3`
+	if l.ch == '.' && isDigit(l.peekChar()) {
+		for l.ch == '.' && isDigit(l.peekChar()) {
+			l.readChar()
+			l.readDigits()
+		}
+
+		literal := l.endLiteral()
+		l.addError(diagnostic.ErrMalformedNumber, start, fmt.Sprintf("Malformed number %q", literal))
+		return token.ILLEGAL, literal
+	}
+
+	return tokenType, l.endLiteral()
+}
+
+// readDigits reads the digits from the current character
+func (l *Lexer) readDigits() {
+	for isDigit(l.ch) {
+		l.readChar()
+	}
 }
 
-// ifDigit checks if the current byte is a digit
-// it checks if the byte in the range of [0-9]
-func isDigit(ch byte) bool {
+// ifDigit checks if the current character is a digit
+// it checks if the character in the range of [0-9]
+func isDigit(ch rune) bool {
 	return '0' <= ch && ch <= '9'
 }
@@ -1,8 +1,14 @@
 package lexer
 
 import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
 	"testing"
+	"testing/iotest"
 
+	"github.com/shavit/go-interpreter/diagnostic"
 	"github.com/shavit/go-interpreter/token"
 )
 
@@ -15,7 +21,7 @@ let add = fn(x, y){
 };
 
 let result = add(twelve,four);
-!-/*9;
+!-/ *9;
 3 < 10 > 7;
 
 if (0<42){
@@ -26,6 +32,8 @@ return false;
 
 18 == 18;
 19 != 17;
+[1, 2][0];
+{"a": 1}
 `
 
 	tests := []struct {
@@ -105,6 +113,20 @@ return false;
 		{token.NOT_EQ, "!="},
 		{token.INT, "17"},
 		{token.SEMICOLON, ";"},
+		{token.LBRACKET, "["},
+		{token.INT, "1"},
+		{token.COMMA, ","},
+		{token.INT, "2"},
+		{token.RBRACKET, "]"},
+		{token.LBRACKET, "["},
+		{token.INT, "0"},
+		{token.RBRACKET, "]"},
+		{token.SEMICOLON, ";"},
+		{token.LBRACE, "{"},
+		{token.STRING, `"a"`},
+		{token.COLON, ":"},
+		{token.INT, "1"},
+		{token.RBRACE, "}"},
 		{token.EOF, ""},
 	}
 
@@ -122,3 +144,510 @@ return false;
 		}
 	}
 }
+
+func TestNumbers(t *testing.T) {
+	input := `3.14 1e-9 .5 2E+10 1.5e3 42 7. 1.x`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.FLOAT, "3.14"},
+		{token.FLOAT, "1e-9"},
+		{token.FLOAT, ".5"},
+		{token.FLOAT, "2E+10"},
+		{token.FLOAT, "1.5e3"},
+		{token.INT, "42"},
+		// A dot without digits after it is not part of the number
+		{token.INT, "7"},
+		{token.ILLEGAL, "."},
+		{token.INT, "1"},
+		{token.ILLEGAL, "."},
+		{token.IDENT, "x"},
+		{token.EOF, ""},
+	}
+
+	lxr := New(input)
+
+	for i, item := range tests {
+		tkn := lxr.NextToken()
+
+		if tkn.Type != item.expectedType || tkn.Literal != item.expectedLiteral {
+			t.Fatalf("Error at %d: Got: %s %q, while expecting: %s %q", i, tkn.Type, tkn.Literal, item.expectedType, item.expectedLiteral)
+		}
+	}
+}
+
+func TestLogicalOperators(t *testing.T) {
+	input := `a && b || !c & d | e`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.IDENT, "a"},
+		{token.AND, "&&"},
+		{token.IDENT, "b"},
+		{token.OR, "||"},
+		{token.BANG, "!"},
+		{token.IDENT, "c"},
+		// Single & and | are not operators
+		{token.ILLEGAL, "&"},
+		{token.IDENT, "d"},
+		{token.ILLEGAL, "|"},
+		{token.IDENT, "e"},
+		{token.EOF, ""},
+	}
+
+	lxr := New(input)
+
+	for i, item := range tests {
+		tkn := lxr.NextToken()
+
+		if tkn.Type != item.expectedType || tkn.Literal != item.expectedLiteral {
+			t.Fatalf("Error at %d: Got: %s %q, while expecting: %s %q", i, tkn.Type, tkn.Literal, item.expectedType, item.expectedLiteral)
+		}
+	}
+
+	errors := lxr.Errors()
+	if len(errors) != 2 || errors[0].Message != `Unexpected character "&"` || errors[0].Start.Column != 14 {
+		t.Errorf("Found %v, while expecting errors for & and |", errors)
+	}
+}
+
+func TestTokenPositions(t *testing.T) {
+	input := "let x = 5;\n\tx == 10;\n"
+
+	tests := []struct {
+		expectedLiteral string
+		expectedPos     token.Position
+	}{
+		{"let", token.Position{Filename: "main.mk", Offset: 0, Line: 1, Column: 1}},
+		{"x", token.Position{Filename: "main.mk", Offset: 4, Line: 1, Column: 5}},
+		{"=", token.Position{Filename: "main.mk", Offset: 6, Line: 1, Column: 7}},
+		{"5", token.Position{Filename: "main.mk", Offset: 8, Line: 1, Column: 9}},
+		{";", token.Position{Filename: "main.mk", Offset: 9, Line: 1, Column: 10}},
+		{"x", token.Position{Filename: "main.mk", Offset: 12, Line: 2, Column: 2}},
+		{"==", token.Position{Filename: "main.mk", Offset: 14, Line: 2, Column: 4}},
+		{"10", token.Position{Filename: "main.mk", Offset: 17, Line: 2, Column: 7}},
+		{";", token.Position{Filename: "main.mk", Offset: 19, Line: 2, Column: 9}},
+		{"", token.Position{Filename: "main.mk", Offset: 21, Line: 3, Column: 1}},
+	}
+
+	lxr := NewFile("main.mk", input)
+
+	for i, item := range tests {
+		tkn := lxr.NextToken()
+
+		if tkn.Literal != item.expectedLiteral {
+			t.Fatalf("Error at %d: Got: %q, while expecting: %q", i, tkn.Literal, item.expectedLiteral)
+		}
+
+		if tkn.Pos != item.expectedPos {
+			t.Fatalf("Error at %d: Got: %s, while expecting: %s", i, tkn.Pos, item.expectedPos)
+		}
+	}
+
+	if s := tests[5].expectedPos.String(); s != "main.mk:2:2" {
+		t.Errorf("Got: %q, while expecting: %q", s, "main.mk:2:2")
+	}
+}
+
+// Strings can span lines, so the end of every token is the position of
+//  the next one when there is no space between them
+func TestTokenEnd(t *testing.T) {
+	input := "\"a\nbc\"+\"é\n\n\"x"
+
+	lxr := NewFile("main.mk", input)
+	prev := lxr.NextToken()
+
+	for prev.Type != token.EOF {
+		tkn := lxr.NextToken()
+
+		if end := prev.End(); end != tkn.Pos {
+			t.Errorf("Found end %+v of %q, while expecting %+v", end, prev.Literal, tkn.Pos)
+		}
+		prev = tkn
+	}
+
+	end := token.Token{Literal: "\"a\nbc\"", Pos: token.Position{Line: 1, Column: 1}}.End()
+	if expected := (token.Position{Offset: 6, Line: 2, Column: 4}); end != expected {
+		t.Errorf("Found %+v, while expecting %+v", end, expected)
+	}
+}
+
+func TestStringLiterals(t *testing.T) {
+	input := `"hello world" "tab\tnew\nline" "quote \" and \\" "\u{e9}t\u{E9}" ""`
+
+	tests := []struct {
+		expectedLiteral string
+		expectedValue   string
+	}{
+		{`"hello world"`, "hello world"},
+		{`"tab\tnew\nline"`, "tab\tnew\nline"},
+		{`"quote \" and \\"`, `quote " and \`},
+		{`"\u{e9}t\u{E9}"`, "été"},
+		{`""`, ""},
+	}
+
+	lxr := New(input)
+
+	for i, item := range tests {
+		tkn := lxr.NextToken()
+
+		if tkn.Type != token.STRING {
+			t.Fatalf("Error at %d: Got: %q, while expecting: %q", i, tkn.Type, token.STRING)
+		}
+
+		if tkn.Literal != item.expectedLiteral {
+			t.Fatalf("Error at %d: Got: %q, while expecting: %q", i, tkn.Literal, item.expectedLiteral)
+		}
+
+		value, err := Unquote(tkn.Literal)
+		if err != nil {
+			t.Fatalf("Error at %d: %v", i, err)
+		}
+
+		if value != item.expectedValue {
+			t.Fatalf("Error at %d: Got: %q, while expecting: %q", i, value, item.expectedValue)
+		}
+	}
+
+	if errs := lxr.Errors(); len(errs) != 0 {
+		t.Fatalf("Got %d errors, while expecting none: %v", len(errs), errs)
+	}
+}
+
+func TestQuote(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected string
+	}{
+		{"hello", `"hello"`},
+		{"tab\tnew\nline\r", `"tab\tnew\nline\r"`},
+		{`quote " and \`, `"quote \" and \\"`},
+		{"été\x00", `"été\u{0}"`},
+	}
+
+	for i, item := range tests {
+		literal := Quote(item.value)
+		if literal != item.expected {
+			t.Fatalf("Error at %d: Got: %q, while expecting: %q", i, literal, item.expected)
+		}
+
+		value, err := Unquote(literal)
+		if err != nil || value != item.value {
+			t.Fatalf("Error at %d: Got: %q (%v), while expecting: %q", i, value, err, item.value)
+		}
+	}
+}
+
+func TestUnquoteErrors(t *testing.T) {
+	tests := []struct {
+		literal  string
+		expected string
+	}{
+		{`hello`, "String literals must be double quoted"},
+		{`"\"`, "Unterminated escape sequence"},
+		{`"\q"`, `Unknown escape sequence "\\q"`},
+		{`"\u}"`, `Unicode escape sequences must be written as \u{...}`},
+		{`"\u{"`, `Unterminated unicode escape sequence "\\u{"`},
+		{`"\ux{41}"`, `Unicode escape sequences must be written as \u{...}`},
+		{`"\u{}"`, `Unicode escape sequence "\\u{}" must have 1 to 6 hex digits`},
+		{`"\u{110000}"`, `Invalid unicode code point in "\\u{110000}"`},
+	}
+
+	for _, tt := range tests {
+		_, err := Unquote(tt.literal)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("Found error %v, while expecting %q for %s", err, tt.expected, tt.literal)
+		}
+	}
+}
+
+func TestInvalidStringLiterals(t *testing.T) {
+	tests := []struct {
+		input        string
+		expectedCode diagnostic.Code
+	}{
+		{`"unterminated`, diagnostic.ErrUnterminatedString},
+		{`"unterminated\`, diagnostic.ErrUnterminatedString},
+		{`"bad \q escape"`, diagnostic.ErrInvalidEscape},
+		{`"bad \é escape"`, diagnostic.ErrInvalidEscape},
+		{`"bad \u{110000} escape"`, diagnostic.ErrInvalidEscape},
+		{`"bad \u{} escape"`, diagnostic.ErrInvalidEscape},
+		{`@`, diagnostic.ErrIllegalCharacter},
+		{`1e`, diagnostic.ErrMalformedNumber},
+		{`2.5E+`, diagnostic.ErrMalformedNumber},
+		{`1.2.3`, diagnostic.ErrMalformedNumber},
+		{`.5.5`, diagnostic.ErrMalformedNumber},
+		{`1e5.3`, diagnostic.ErrMalformedNumber},
+	}
+
+	for _, item := range tests {
+		lxr := New(item.input)
+		tkn := lxr.NextToken()
+
+		if tkn.Type != token.ILLEGAL {
+			t.Errorf("Got: %q, while expecting: %q for %s", tkn.Type, token.ILLEGAL, item.input)
+		}
+
+		if next := lxr.NextToken(); next.Type != token.EOF {
+			t.Errorf("Got: %q, while expecting: %q after %s", next.Type, token.EOF, item.input)
+		}
+
+		errs := lxr.Errors()
+		if len(errs) != 1 {
+			t.Fatalf("Got %d errors, while expecting 1 for %s", len(errs), item.input)
+		}
+
+		if errs[0].Code != item.expectedCode {
+			t.Errorf("Got: %s, while expecting: %s for %s", errs[0].Code, item.expectedCode, item.input)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := `// leading
+let x = 1; // trailing
+/* block /* nested */ still comment */ x / 2;`
+
+	expected := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.LET, "let"},
+		{token.IDENT, "x"},
+		{token.ASSIGN, "="},
+		{token.INT, "1"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "x"},
+		{token.SLASH, "/"},
+		{token.INT, "2"},
+		{token.SEMICOLON, ";"},
+		{token.EOF, ""},
+	}
+
+	lxr := New(input)
+	for i, item := range expected {
+		tkn := lxr.NextToken()
+		if tkn.Type != item.expectedType || tkn.Literal != item.expectedLiteral {
+			t.Fatalf("Error at %d: Got: %s %q, while expecting: %s %q", i, tkn.Type, tkn.Literal, item.expectedType, item.expectedLiteral)
+		}
+	}
+
+	// Scan the comments as tokens
+	lxr = New(input)
+	lxr.SetMode(ScanComments)
+
+	var comments []string
+	for tkn := lxr.NextToken(); tkn.Type != token.EOF; tkn = lxr.NextToken() {
+		if tkn.Type == token.COMMENT {
+			comments = append(comments, tkn.Literal)
+		}
+	}
+
+	if len(comments) != 3 || comments[0] != "// leading" || comments[1] != "// trailing" || comments[2] != "/* block /* nested */ still comment */" {
+		t.Fatalf("Got: %q, while expecting the three comments", comments)
+	}
+
+	// Attach the comments to the next tokens
+	lxr = New(input)
+	lxr.SetMode(AttachComments)
+
+	let := lxr.NextToken()
+	if len(let.Leading) != 1 || let.Leading[0].Literal != "// leading" || let.Leading[0].Pos.Line != 1 {
+		t.Fatalf("Got: %+v, while expecting the leading comment on let", let.Leading)
+	}
+
+	for i := 0; i < 4; i++ {
+		lxr.NextToken()
+	}
+
+	x := lxr.NextToken()
+	if x.Literal != "x" || len(x.Leading) != 2 {
+		t.Fatalf("Got: %q with %+v, while expecting x with two comments", x.Literal, x.Leading)
+	}
+}
+
+func TestUnterminatedComment(t *testing.T) {
+	lxr := New("x /* open /* nested */")
+	lxr.NextToken()
+
+	tkn := lxr.NextToken()
+	if tkn.Type != token.ILLEGAL {
+		t.Fatalf("Got: %q, while expecting: %q", tkn.Type, token.ILLEGAL)
+	}
+
+	errs := lxr.Errors()
+	if len(errs) != 1 || errs[0].Code != diagnostic.ErrUnterminatedComment {
+		t.Fatalf("Got: %v, while expecting an unterminated comment error", errs)
+	}
+
+	if errs[0].Start.Column != 3 {
+		t.Errorf("Got column %d, while expecting 3", errs[0].Start.Column)
+	}
+}
+
+func TestUnicodeIdentifiers(t *testing.T) {
+	input := "let x1 = café + _tmp2 * 日本語; größe3"
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+		expectedColumn  int
+	}{
+		{token.LET, "let", 1},
+		{token.IDENT, "x1", 5},
+		{token.ASSIGN, "=", 8},
+		{token.IDENT, "café", 10},
+		{token.PLUS, "+", 15},
+		{token.IDENT, "_tmp2", 17},
+		{token.ASTERISK, "*", 23},
+		{token.IDENT, "日本語", 25},
+		{token.SEMICOLON, ";", 28},
+		{token.IDENT, "größe3", 30},
+		{token.EOF, "", 36},
+	}
+
+	lxr := New(input)
+
+	for i, item := range tests {
+		tkn := lxr.NextToken()
+
+		if tkn.Type != item.expectedType || tkn.Literal != item.expectedLiteral {
+			t.Fatalf("Error at %d: Got: %s %q, while expecting: %s %q", i, tkn.Type, tkn.Literal, item.expectedType, item.expectedLiteral)
+		}
+
+		if tkn.Pos.Column != item.expectedColumn {
+			t.Fatalf("Error at %d: Got column %d, while expecting: %d", i, tkn.Pos.Column, item.expectedColumn)
+		}
+	}
+}
+
+func TestInvalidUTF8(t *testing.T) {
+	lxr := New("let é\xffx = 1;")
+
+	expected := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.LET, "let"},
+		{token.IDENT, "é"},
+		{token.ILLEGAL, "\xff"},
+		{token.IDENT, "x"},
+		{token.ASSIGN, "="},
+	}
+
+	for i, item := range expected {
+		tkn := lxr.NextToken()
+		if tkn.Type != item.expectedType || tkn.Literal != item.expectedLiteral {
+			t.Fatalf("Error at %d: Got: %s %q, while expecting: %s %q", i, tkn.Type, tkn.Literal, item.expectedType, item.expectedLiteral)
+		}
+	}
+
+	errs := lxr.Errors()
+	if len(errs) != 1 || errs[0].Code != diagnostic.ErrInvalidUTF8 {
+		t.Fatalf("Got: %v, while expecting an invalid encoding error", errs)
+	}
+
+	if errs[0].Start.Offset != 6 || errs[0].Start.Column != 6 {
+		t.Errorf("Got: offset %d column %d, while expecting offset 6 column 6", errs[0].Start.Offset, errs[0].Start.Column)
+	}
+}
+
+// Every token longer than a byte spans a read of the one byte reader
+func TestReaderOneByteAtATime(t *testing.T) {
+	input := "// comment\nlet café = \"tab\\t\\u{1F600}\";\n/* block */ x @ é\xff"
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+		expectedPos     token.Position
+	}{
+		{token.COMMENT, "// comment", token.Position{Offset: 0, Line: 1, Column: 1}},
+		{token.LET, "let", token.Position{Offset: 11, Line: 2, Column: 1}},
+		{token.IDENT, "café", token.Position{Offset: 15, Line: 2, Column: 5}},
+		{token.ASSIGN, "=", token.Position{Offset: 21, Line: 2, Column: 10}},
+		{token.STRING, `"tab\t\u{1F600}"`, token.Position{Offset: 23, Line: 2, Column: 12}},
+		{token.SEMICOLON, ";", token.Position{Offset: 39, Line: 2, Column: 28}},
+		{token.COMMENT, "/* block */", token.Position{Offset: 41, Line: 3, Column: 1}},
+		{token.IDENT, "x", token.Position{Offset: 53, Line: 3, Column: 13}},
+		{token.ILLEGAL, "@", token.Position{Offset: 55, Line: 3, Column: 15}},
+		{token.IDENT, "é", token.Position{Offset: 57, Line: 3, Column: 17}},
+		{token.ILLEGAL, "\xff", token.Position{Offset: 59, Line: 3, Column: 18}},
+		{token.EOF, "", token.Position{Offset: 60, Line: 3, Column: 19}},
+	}
+
+	lxr := NewReader("", iotest.OneByteReader(strings.NewReader(input)))
+	lxr.SetMode(ScanComments)
+
+	for i, item := range tests {
+		tkn := lxr.NextToken()
+
+		if tkn.Type != item.expectedType || tkn.Literal != item.expectedLiteral || tkn.Pos != item.expectedPos {
+			t.Fatalf("Error at %d: Got: %s %q at %+v, while expecting: %s %q at %+v", i, tkn.Type, tkn.Literal, tkn.Pos, item.expectedType, item.expectedLiteral, item.expectedPos)
+		}
+	}
+
+	if errs := lxr.Errors(); len(errs) != 2 {
+		t.Fatalf("Got %d errors, while expecting 2: %v", len(errs), errs)
+	}
+}
+
+// Skipped comments are not recorded, so only their delimiter is left
+func TestSkippedCommentsAreNotRecorded(t *testing.T) {
+	lxr := New("/* " + strings.Repeat("long ", 1000))
+
+	tkn := lxr.NextToken()
+	if tkn.Type != token.ILLEGAL || tkn.Literal != "/*" {
+		t.Errorf("Got: %s %q, while expecting: ILLEGAL \"/*\"", tkn.Type, tkn.Literal)
+	}
+}
+
+func TestReaderLargeInput(t *testing.T) {
+	const statements = 200000
+	r, w := io.Pipe()
+
+	go func() {
+		for i := 0; i < statements; i++ {
+			fmt.Fprintf(w, "let x%d = %d + y;\n", i, i)
+		}
+		w.Close()
+	}()
+
+	lxr := NewReader("generated.mk", r)
+	count := 0
+	var last token.Token
+	for tkn := lxr.NextToken(); tkn.Type != token.EOF; tkn = lxr.NextToken() {
+		count += 1
+		last = tkn
+	}
+
+	if count != statements*7 {
+		t.Errorf("Got %d tokens, while expecting %d", count, statements*7)
+	}
+
+	if last.Pos.Line != statements || last.Pos.Filename != "generated.mk" {
+		t.Errorf("Got: %s, while expecting the last token on line %d", last.Pos, statements)
+	}
+}
+
+func TestReaderError(t *testing.T) {
+	r := io.MultiReader(strings.NewReader("let x = 1"), iotest.ErrReader(errors.New("disk failure")))
+	lxr := NewReader("broken.mk", r)
+
+	var types []token.TokenType
+	for tkn := lxr.NextToken(); tkn.Type != token.EOF; tkn = lxr.NextToken() {
+		types = append(types, tkn.Type)
+	}
+
+	if len(types) != 4 {
+		t.Errorf("Got %v, while expecting 4 tokens before the error", types)
+	}
+
+	errs := lxr.Errors()
+	if len(errs) != 1 || errs[0].Code != diagnostic.ErrRead {
+		t.Fatalf("Got: %v, while expecting a read error", errs)
+	}
+}
@@ -0,0 +1,204 @@
+package lexer
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/shavit/go-interpreter/diagnostic"
+)
+
+// Escape sequences of a single character, and the characters they
+//  stand for
+var simpleEscapes = map[rune]rune{
+	'n':  '\n',
+	't':  '\t',
+	'r':  '\r',
+	'\\': '\\',
+	'"':  '"',
+}
+
+// readString reads a double quoted string, including the quotes
+// It validates the escape sequences without decoding them, and returns
+//  false when the string is invalid or not terminated
+func (l *Lexer) readString() (string, bool) {
+	start := l.currentPosition()
+	ok := true
+
+	// Skip the opening quote
+	l.startLiteral()
+	l.readChar()
+
+	for l.ch != '"' {
+		if l.ch == 0 {
+			l.addError(diagnostic.ErrUnterminatedString, start, "Unterminated string literal")
+			return l.endLiteral(), false
+		}
+
+		if l.ch == '\\' {
+			if !l.readEscape() {
+				ok = false
+			}
+			continue
+		}
+
+		l.readChar()
+	}
+
+	// Skip the closing quote
+	l.readChar()
+
+	return l.endLiteral(), ok
+}
+
+// readEscape reads an escape sequence that starts at the backslash
+// It stops on the character after the escape sequence
+func (l *Lexer) readEscape() bool {
+	start := l.currentPosition()
+	escapeStart := len(l.recorded())
+
+	l.readChar()
+	if l.ch == 0 {
+		// The unterminated string is reported by the caller
+		return false
+	}
+
+	if _, ok := simpleEscapes[l.ch]; ok {
+		l.readChar()
+		return true
+	}
+
+	if l.ch != 'u' {
+		l.readChar()
+		l.addError(diagnostic.ErrInvalidEscape, start, fmt.Sprintf("Unknown escape sequence %q", l.recorded()[escapeStart:]))
+		return false
+	}
+
+	// Unicode escapes are hex digits between braces, for example \u{1F600}
+	l.readChar()
+	if l.ch != '{' {
+		l.addError(diagnostic.ErrInvalidEscape, start, `Unicode escape sequences must be written as \u{...}`)
+		return false
+	}
+
+	l.readChar()
+	for isHexDigit(l.ch) {
+		l.readChar()
+	}
+
+	if l.ch != '}' {
+		l.addError(diagnostic.ErrInvalidEscape, start, fmt.Sprintf("Unterminated unicode escape sequence %q", l.recorded()[escapeStart:]))
+		return false
+	}
+
+	l.readChar()
+
+	if _, err := decodeUnicodeEscape(l.recorded()[escapeStart:]); err != nil {
+		l.addError(diagnostic.ErrInvalidEscape, start, err.Error())
+		return false
+	}
+
+	return true
+}
+
+// decodeUnicodeEscape decodes an escape sequence like \u{e9}
+func decodeUnicodeEscape(escape string) (rune, error) {
+	if len(escape) < 4 || !strings.HasPrefix(escape, `\u{`) || !strings.HasSuffix(escape, "}") {
+		return 0, errors.New(`Unicode escape sequences must be written as \u{...}`)
+	}
+
+	digits := escape[3 : len(escape)-1]
+	if len(digits) == 0 || len(digits) > 6 {
+		return 0, fmt.Errorf("Unicode escape sequence %q must have 1 to 6 hex digits", escape)
+	}
+
+	value, err := strconv.ParseUint(digits, 16, 32)
+	if err != nil || !utf8.ValidRune(rune(value)) {
+		return 0, fmt.Errorf("Invalid unicode code point in %q", escape)
+	}
+
+	return rune(value), nil
+}
+
+// Unquote decodes the literal of a string token
+// The literal includes the quotes, like the lexer returns it
+func Unquote(literal string) (string, error) {
+	if len(literal) < 2 || literal[0] != '"' || literal[len(literal)-1] != '"' {
+		return "", errors.New("String literals must be double quoted")
+	}
+
+	var buf strings.Builder
+	s := literal[1 : len(literal)-1]
+
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			buf.WriteByte(s[i])
+			continue
+		}
+
+		if i+1 >= len(s) {
+			return "", errors.New("Unterminated escape sequence")
+		}
+		i += 1
+
+		if ch, ok := simpleEscapes[rune(s[i])]; ok {
+			buf.WriteRune(ch)
+			continue
+		}
+
+		if s[i] != 'u' {
+			return "", fmt.Errorf("Unknown escape sequence %q", s[i-1:i+1])
+		}
+
+		end := strings.IndexByte(s[i:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("Unterminated unicode escape sequence %q", s[i-1:])
+		}
+
+		r, err := decodeUnicodeEscape(s[i-1 : i+end+1])
+		if err != nil {
+			return "", err
+		}
+		buf.WriteRune(r)
+		i += end
+	}
+
+	return buf.String(), nil
+}
+
+// Quote encodes a string as a string literal, that Unquote decodes
+// Characters that are not printable are written as unicode escapes
+func Quote(s string) string {
+	var buf strings.Builder
+	buf.WriteByte('"')
+
+	for _, ch := range s {
+		switch {
+		case ch == '\\' || ch == '"':
+			buf.WriteByte('\\')
+			buf.WriteRune(ch)
+		case ch == '\n':
+			buf.WriteString(`\n`)
+		case ch == '\t':
+			buf.WriteString(`\t`)
+		case ch == '\r':
+			buf.WriteString(`\r`)
+		case !unicode.IsPrint(ch):
+			fmt.Fprintf(&buf, `\u{%x}`, ch)
+		default:
+			buf.WriteRune(ch)
+		}
+	}
+
+	buf.WriteByte('"')
+
+	return buf.String()
+}
+
+// isHexDigit checks if the character is in the range of [0-9a-fA-F]
+func isHexDigit(ch rune) bool {
+	return isDigit(ch) || 'a' <= ch && ch <= 'f' || 'A' <= ch && ch <= 'F'
+}
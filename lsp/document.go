@@ -0,0 +1,237 @@
+package lsp
+
+import (
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/shavit/go-interpreter/ast"
+	"github.com/shavit/go-interpreter/diagnostic"
+	"github.com/shavit/go-interpreter/lexer"
+	"github.com/shavit/go-interpreter/parser"
+	"github.com/shavit/go-interpreter/token"
+)
+
+// document is an open file, with its tree and the tokens of its source
+// It is parsed again on every change
+type document struct {
+	uri     string
+	version int
+	text    string
+
+	// Byte offsets of the start of every line
+	lines []int
+
+	program *ast.Program
+	errors  []diagnostic.Diagnostic
+
+	// Every token of the source, including the comments
+	tokens []token.Token
+
+	// Closing braces and brackets by the offset of their opening token
+	closing map[int]token.Token
+
+	names resolution
+}
+
+// Closing tokens by their opening token
+var pairs = map[token.TokenType]token.TokenType{
+	token.LBRACE:   token.RBRACE,
+	token.LBRACKET: token.RBRACKET,
+}
+
+// newDocument parses the text of a document
+func newDocument(uri string, version int, text string) *document {
+	d := &document{uri: uri, version: version, text: text, lines: []int{0}}
+
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\n' {
+			d.lines = append(d.lines, i+1)
+		}
+	}
+
+	p := parser.New(lexer.NewFile(uri, text))
+	d.program = p.ParseProgram()
+	d.errors = p.Errors()
+
+	d.closing = map[int]token.Token{}
+	var open []token.Token
+
+	l := lexer.NewFile(uri, text)
+	l.SetMode(lexer.ScanComments)
+	for tkn := l.NextToken(); tkn.Type != token.EOF; tkn = l.NextToken() {
+		d.tokens = append(d.tokens, tkn)
+
+		switch tkn.Type {
+		case token.LBRACE, token.LBRACKET:
+			open = append(open, tkn)
+		case token.RBRACE, token.RBRACKET:
+			if len(open) > 0 && pairs[open[len(open)-1].Type] == tkn.Type {
+				d.closing[open[len(open)-1].Pos.Offset] = tkn
+				open = open[:len(open)-1]
+			}
+		}
+	}
+
+	d.names = resolve(d.program)
+
+	return d
+}
+
+// applyChange returns the text of the document after a change
+func (d *document) applyChange(change TextDocumentContentChangeEvent) string {
+	if change.Range == nil {
+		return change.Text
+	}
+
+	start := d.offset(change.Range.Start)
+	end := max(start, d.offset(change.Range.End))
+
+	return d.text[:start] + change.Text + d.text[end:]
+}
+
+// position converts the position of a token to an LSP position
+func (d *document) position(pos token.Position) Position {
+	line := min(max(pos.Line-1, 0), len(d.lines)-1)
+	start := d.lines[line]
+	offset := min(max(pos.Offset, start), len(d.text))
+
+	return Position{Line: line, Character: utf16Len(d.text[start:offset])}
+}
+
+// rangeOf converts a span of the source to an LSP range
+func (d *document) rangeOf(start, end token.Position) Range {
+	return Range{Start: d.position(start), End: d.position(end)}
+}
+
+// tokenRange returns the range of a token
+func (d *document) tokenRange(tkn token.Token) Range {
+	return d.rangeOf(tkn.Pos, tkn.End())
+}
+
+// offset converts an LSP position to a byte offset in the text
+// Positions after the end of a line are moved to the end of the line
+func (d *document) offset(pos Position) int {
+	if pos.Line < 0 {
+		return 0
+	}
+	if pos.Line >= len(d.lines) {
+		return len(d.text)
+	}
+
+	offset := d.lines[pos.Line]
+	for units := 0; units < pos.Character && offset < len(d.text); {
+		r, size := utf8.DecodeRuneInString(d.text[offset:])
+		if r == '\n' {
+			break
+		}
+
+		units += utf16.RuneLen(r)
+		offset += size
+	}
+
+	return offset
+}
+
+// utf16Len returns the length of a string in UTF-16 code units
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		n += max(utf16.RuneLen(r), 1)
+	}
+
+	return n
+}
+
+// identifierAt returns the identifier at an offset, including the
+//  offset right after it
+func (d *document) identifierAt(offset int) *ast.Identifier {
+	for _, ident := range d.names.identifiers {
+		start := ident.Token.Pos.Offset
+		if start <= offset && offset <= start+len(ident.Token.Literal) {
+			return ident
+		}
+	}
+
+	return nil
+}
+
+// end returns the position after the last token of a node
+// The closing braces and brackets are not in the tree, so they are
+//  found in the tokens of the source
+func (d *document) end(node ast.Node) token.Position {
+	var end token.Position
+
+	ast.Inspect(node, func(n ast.Node) bool {
+		var tkn token.Token
+
+		switch n := n.(type) {
+		case *ast.LetStatement:
+			tkn = n.Token
+		case *ast.ReturnStatement:
+			tkn = n.Token
+		case *ast.ExpressionStatement:
+			tkn = n.Token
+		case *ast.BlockStatement:
+			tkn = n.Token
+			if rbrace, ok := d.closing[n.Token.Pos.Offset]; ok {
+				tkn = rbrace
+			}
+		case *ast.Identifier:
+			tkn = n.Token
+		case *ast.IntegerLiteral:
+			tkn = n.Token
+		case *ast.FloatLiteral:
+			tkn = n.Token
+		case *ast.StringLiteral:
+			tkn = n.Token
+		case *ast.BooleanLiteral:
+			tkn = n.Token
+		case *ast.PrefixExpression:
+			tkn = n.Token
+		case *ast.InfixExpression:
+			tkn = n.Token
+		case *ast.LogicalExpression:
+			tkn = n.Token
+		case *ast.IfExpression:
+			tkn = n.Token
+		case *ast.FunctionLiteral:
+			tkn = n.Token
+		case *ast.CallExpression:
+			tkn = n.Token
+		case *ast.ArrayLiteral:
+			tkn = n.Token
+			if rbracket, ok := d.closing[n.Token.Pos.Offset]; ok {
+				tkn = rbracket
+			}
+		case *ast.HashLiteral:
+			tkn = n.Token
+			if rbrace, ok := d.closing[n.Token.Pos.Offset]; ok {
+				tkn = rbrace
+			}
+		case *ast.IndexExpression:
+			tkn = n.Token
+			if rbracket, ok := d.closing[n.Token.Pos.Offset]; ok {
+				tkn = rbracket
+			}
+		case *ast.BadExpression:
+			tkn = n.Token
+		case *ast.BadStatement:
+			if n.End.Offset > end.Offset {
+				end = n.End
+			}
+			return true
+		default:
+			return true
+		}
+
+		if e := tkn.End(); e.Offset > end.Offset {
+			end = e
+			end.Line = tkn.Pos.Line + strings.Count(tkn.Literal, "\n")
+		}
+
+		return true
+	})
+
+	return end
+}
@@ -0,0 +1,258 @@
+package lsp
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/shavit/go-interpreter/ast"
+	"github.com/shavit/go-interpreter/diagnostic"
+	"github.com/shavit/go-interpreter/format"
+	"github.com/shavit/go-interpreter/token"
+)
+
+// LSP severities by the severity of the diagnostics
+var severities = map[diagnostic.Severity]int{
+	diagnostic.Error:   SeverityError,
+	diagnostic.Warning: SeverityWarning,
+	diagnostic.Note:    SeverityInformation,
+}
+
+// diagnostics converts the parser errors of the document
+func (d *document) diagnostics() []Diagnostic {
+	diagnostics := []Diagnostic{}
+
+	for _, e := range d.errors {
+		message := e.Message
+		if e.Hint != "" {
+			message += "\nhint: " + e.Hint
+		}
+
+		diagnostics = append(diagnostics, Diagnostic{
+			Range:    d.rangeOf(e.Start, e.End),
+			Severity: severities[e.Severity],
+			Code:     string(e.Code),
+			Source:   "go-interpreter",
+			Message:  message,
+		})
+	}
+
+	return diagnostics
+}
+
+// symbols returns the names bound by let statements, with the names
+//  bound inside their values as children
+func (d *document) symbols(node ast.Node) []DocumentSymbol {
+	symbols := []DocumentSymbol{}
+
+	ast.Inspect(node, func(n ast.Node) bool {
+		let, ok := n.(*ast.LetStatement)
+		if !ok || n == node {
+			return true
+		}
+
+		symbol := DocumentSymbol{
+			Name:           let.Name.Value,
+			Detail:         summary(let.Value),
+			Kind:           SymbolVariable,
+			Range:          d.rangeOf(let.Token.Pos, d.end(let)),
+			SelectionRange: d.tokenRange(let.Name.Token),
+		}
+		if _, ok := let.Value.(*ast.FunctionLiteral); ok {
+			symbol.Kind = SymbolFunction
+		}
+
+		if children := d.symbols(let); len(children) > 0 {
+			symbol.Children = children
+		}
+		symbols = append(symbols, symbol)
+
+		return false
+	})
+
+	return symbols
+}
+
+// hover describes the definition of the identifier at a position
+func (d *document) hover(pos Position) *Hover {
+	ident := d.identifierAt(d.offset(pos))
+	if ident == nil {
+		return nil
+	}
+
+	def, ok := d.names.definitions[ident]
+	if !ok {
+		return nil
+	}
+
+	var value string
+	if def.let != nil {
+		value = fmt.Sprintf("let %s = %s", def.name.Value, summary(def.let.Value))
+	} else {
+		value = fmt.Sprintf("parameter %s of %s", def.name.Value, summary(def.fn))
+	}
+
+	r := d.tokenRange(ident.Token)
+
+	return &Hover{
+		Contents: MarkupContent{Kind: "plaintext", Value: value},
+		Range:    &r,
+	}
+}
+
+// definition returns the location of the definition of the identifier
+//  at a position
+func (d *document) definition(pos Position) *Location {
+	ident := d.identifierAt(d.offset(pos))
+	if ident == nil {
+		return nil
+	}
+
+	def, ok := d.names.definitions[ident]
+	if !ok {
+		return nil
+	}
+
+	return &Location{URI: d.uri, Range: d.tokenRange(def.name.Token)}
+}
+
+// summary returns a single line that describes an expression
+// Functions are described by their parameters, and other multi line
+//  expressions by their first line
+func summary(exp ast.Expression) string {
+	if exp == nil {
+		return ""
+	}
+
+	if fn, ok := exp.(*ast.FunctionLiteral); ok {
+		params := make([]string, len(fn.Parameters))
+		for i, param := range fn.Parameters {
+			params[i] = param.Value
+		}
+		return fmt.Sprintf("fn(%s)", strings.Join(params, ", "))
+	}
+
+	s := format.Node(exp)
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		s = s[:i] + " ..."
+	}
+
+	return s
+}
+
+// Semantic token types and modifiers, in the order of the legend
+var (
+	semanticTypes     = []string{"keyword", "variable", "parameter", "function", "string", "number", "operator", "comment"}
+	semanticModifiers = []string{"declaration"}
+)
+
+const (
+	semanticKeyword = iota
+	semanticVariable
+	semanticParameter
+	semanticFunction
+	semanticString
+	semanticNumber
+	semanticOperator
+	semanticComment
+)
+
+// Semantic types by token type, for the tokens that do not depend on
+//  the definitions
+var semanticTokenTypes = map[token.TokenType]int{
+	token.FUNCTION: semanticKeyword,
+	token.LET:      semanticKeyword,
+	token.TRUE:     semanticKeyword,
+	token.FALSE:    semanticKeyword,
+	token.IF:       semanticKeyword,
+	token.ELSE:     semanticKeyword,
+	token.RETURN:   semanticKeyword,
+	token.STRING:   semanticString,
+	token.INT:      semanticNumber,
+	token.FLOAT:    semanticNumber,
+	token.COMMENT:  semanticComment,
+	token.ASSIGN:   semanticOperator,
+	token.PLUS:     semanticOperator,
+	token.MINUS:    semanticOperator,
+	token.BANG:     semanticOperator,
+	token.ASTERISK: semanticOperator,
+	token.SLASH:    semanticOperator,
+	token.LT:       semanticOperator,
+	token.GT:       semanticOperator,
+	token.EQ:       semanticOperator,
+	token.NOT_EQ:   semanticOperator,
+	token.AND:      semanticOperator,
+	token.OR:       semanticOperator,
+}
+
+// semanticTokens encodes the tokens of the lexer with their types
+// Identifiers are typed by their definitions, and tokens that span
+//  multiple lines are split into one token per line
+func (d *document) semanticTokens() SemanticTokens {
+	identifiers := map[int]*ast.Identifier{}
+	for _, ident := range d.names.identifiers {
+		identifiers[ident.Token.Pos.Offset] = ident
+	}
+
+	data := []int{}
+	prevLine, prevChar := 0, 0
+
+	for _, tkn := range d.tokens {
+		typ, modifiers, ok := d.semanticType(tkn, identifiers)
+		if !ok {
+			continue
+		}
+
+		start := d.position(tkn.Pos)
+		for i, part := range strings.Split(tkn.Literal, "\n") {
+			line, char := start.Line+i, 0
+			if i == 0 {
+				char = start.Character
+			}
+
+			length := utf16Len(part)
+			if length == 0 {
+				continue
+			}
+
+			if line != prevLine {
+				prevChar = 0
+			}
+			data = append(data, line-prevLine, char-prevChar, length, typ, modifiers)
+			prevLine, prevChar = line, char
+		}
+	}
+
+	return SemanticTokens{Data: data}
+}
+
+// semanticType returns the type and the modifiers of a token
+func (d *document) semanticType(tkn token.Token, identifiers map[int]*ast.Identifier) (int, int, bool) {
+	if tkn.Type != token.IDENT {
+		typ, ok := semanticTokenTypes[tkn.Type]
+		return typ, 0, ok
+	}
+
+	ident, ok := identifiers[tkn.Pos.Offset]
+	if !ok {
+		return semanticVariable, 0, true
+	}
+
+	def, ok := d.names.definitions[ident]
+	if !ok {
+		return semanticVariable, 0, true
+	}
+
+	modifiers := 0
+	if def.name == ident {
+		modifiers = 1
+	}
+
+	switch {
+	case def.fn != nil:
+		return semanticParameter, modifiers, true
+	case def.isFunction():
+		return semanticFunction, modifiers, true
+	default:
+		return semanticVariable, modifiers, true
+	}
+}
@@ -0,0 +1,157 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"sync"
+)
+
+// JSON-RPC error codes
+const (
+	codeParseError           = -32700
+	codeInvalidRequest       = -32600
+	codeMethodNotFound       = -32601
+	codeInvalidParams        = -32602
+	codeServerNotInitialized = -32002
+)
+
+// maxContentLength is the size of the largest message
+// Larger messages are rejected before they are read, so a client cannot
+//  make the server allocate any amount of memory
+const maxContentLength = 64 << 20
+
+// message is a JSON-RPC request, response or notification
+// Notifications have no id, and responses have no method
+type message struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method,omitempty"`
+	Params  json.RawMessage  `json:"params,omitempty"`
+	Result  json.RawMessage  `json:"result,omitempty"`
+	Error   *responseError   `json:"error,omitempty"`
+}
+
+// isNotification checks if the message does not expect a response
+func (m *message) isNotification() bool {
+	return m.ID == nil
+}
+
+// responseError is the error of a failed request
+type responseError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *responseError) Error() string {
+	return fmt.Sprintf("%s (%d)", e.Message, e.Code)
+}
+
+// conn reads and writes messages with the base protocol of LSP
+// Every message has a header with its Content-Length, followed by an
+//  empty line and the JSON content
+type conn struct {
+	r *textproto.Reader
+
+	// Responses and notifications can be written from any goroutine
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// newConn creates a connection from a pair of streams
+func newConn(r io.Reader, w io.Writer) *conn {
+	return &conn{r: textproto.NewReader(bufio.NewReader(r)), w: w}
+}
+
+// read reads the next message
+// It returns io.EOF when the stream is closed between messages
+func (c *conn) read() (*message, error) {
+	header, err := c.r.ReadMIMEHeader()
+	if err != nil {
+		if err == io.EOF && len(header) == 0 {
+			return nil, io.EOF
+		}
+		return nil, fmt.Errorf("Could not read the header: %v", err)
+	}
+
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil || length < 0 {
+		return nil, fmt.Errorf("Invalid Content-Length %q", header.Get("Content-Length"))
+	}
+	if length > maxContentLength {
+		return nil, fmt.Errorf("Content-Length %d is larger than the limit of %d bytes", length, maxContentLength)
+	}
+
+	content := make([]byte, length)
+	if _, err := io.ReadFull(c.r.R, content); err != nil {
+		return nil, fmt.Errorf("Could not read the content: %v", err)
+	}
+
+	msg := new(message)
+	if err := json.Unmarshal(content, msg); err != nil {
+		return nil, &responseError{Code: codeParseError, Message: err.Error()}
+	}
+
+	return msg, nil
+}
+
+// write writes a message with its header
+func (c *conn) write(msg *message) error {
+	msg.JSONRPC = "2.0"
+
+	content, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, err := fmt.Fprintf(c.w, "Content-Length: %d\r\n\r\n", len(content)); err != nil {
+		return err
+	}
+	_, err = c.w.Write(content)
+
+	return err
+}
+
+// reply writes the result of a request, or its error
+// The id is null when the id of the request is unknown, since responses
+//  always have one
+func (c *conn) reply(id *json.RawMessage, result interface{}, err error) error {
+	if id == nil {
+		null := json.RawMessage("null")
+		id = &null
+	}
+	msg := &message{ID: id}
+
+	if err != nil {
+		rerr, ok := err.(*responseError)
+		if !ok {
+			rerr = &responseError{Code: codeInvalidRequest, Message: err.Error()}
+		}
+		msg.Error = rerr
+		return c.write(msg)
+	}
+
+	b, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	msg.Result = b
+
+	return c.write(msg)
+}
+
+// notify writes a notification
+func (c *conn) notify(method string, params interface{}) error {
+	b, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+
+	return c.write(&message{Method: method, Params: b})
+}
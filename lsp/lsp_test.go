@@ -0,0 +1,401 @@
+package lsp
+
+import (
+	"encoding/json"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// client talks to a server that runs in a goroutine, through pipes
+type client struct {
+	t    *testing.T
+	conn *conn
+	in   *io.PipeWriter
+	id   int
+	done chan error
+}
+
+func newClient(t *testing.T) *client {
+	serverIn, clientOut := io.Pipe()
+	clientIn, serverOut := io.Pipe()
+
+	c := &client{t: t, conn: newConn(clientIn, clientOut), in: clientOut, done: make(chan error, 1)}
+
+	go func() {
+		err := NewServer(serverIn, serverOut).Serve()
+		serverOut.Close()
+		c.done <- err
+	}()
+
+	return c
+}
+
+// call sends a request, and decodes the result of the response
+func (c *client) call(method string, params, result interface{}) *responseError {
+	c.t.Helper()
+
+	c.id += 1
+	id := json.RawMessage(strconv.Itoa(c.id))
+	c.send(&message{ID: &id, Method: method}, params)
+
+	msg := c.read()
+	if msg.ID == nil || string(*msg.ID) != string(id) {
+		c.t.Fatalf("Found response %+v, while expecting the id %s", msg, id)
+	}
+
+	if msg.Error != nil {
+		return msg.Error
+	}
+
+	if err := json.Unmarshal(msg.Result, result); err != nil {
+		c.t.Fatalf("Found error %v, while decoding %s", err, msg.Result)
+	}
+
+	return nil
+}
+
+// notify sends a notification
+func (c *client) notify(method string, params interface{}) {
+	c.t.Helper()
+	c.send(&message{Method: method}, params)
+}
+
+func (c *client) send(msg *message, params interface{}) {
+	c.t.Helper()
+
+	b, err := json.Marshal(params)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	msg.Params = b
+
+	if err := c.conn.write(msg); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func (c *client) read() *message {
+	c.t.Helper()
+
+	msg, err := c.conn.read()
+	if err != nil {
+		c.t.Fatalf("Found error %v, while reading a message", err)
+	}
+
+	return msg
+}
+
+// diagnostics reads the next published diagnostics
+func (c *client) diagnostics() PublishDiagnosticsParams {
+	c.t.Helper()
+
+	msg := c.read()
+	if msg.Method != "textDocument/publishDiagnostics" {
+		c.t.Fatalf("Found %+v, while expecting diagnostics", msg)
+	}
+
+	var params PublishDiagnosticsParams
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		c.t.Fatal(err)
+	}
+
+	return params
+}
+
+// initialize starts a session, and opens a document
+func initialize(t *testing.T, text string) *client {
+	c := newClient(t)
+
+	var result InitializeResult
+	if err := c.call("initialize", InitializeParams{}, &result); err != nil {
+		t.Fatalf("Found error %v", err)
+	}
+	c.notify("initialized", struct{}{})
+
+	c.notify("textDocument/didOpen", DidOpenTextDocumentParams{
+		TextDocument: TextDocumentItem{URI: testURI, LanguageID: "monkey", Version: 1, Text: text},
+	})
+
+	return c
+}
+
+// shutdown ends the session, and waits for the server
+func (c *client) shutdown() {
+	c.t.Helper()
+
+	var result interface{}
+	if err := c.call("shutdown", nil, &result); err != nil {
+		c.t.Fatalf("Found error %v", err)
+	}
+	c.notify("exit", nil)
+	c.in.Close()
+
+	if err := <-c.done; err != nil {
+		c.t.Errorf("Found error %v, while expecting the server to exit", err)
+	}
+}
+
+const testURI = "file:///test.mk"
+
+var testSource = `let add = fn(x, y) {
+  let sum = x + y;
+  sum
+};
+// 😀 is two UTF-16 code units
+let s = "😀"; add(s, 1)`
+
+func TestInitialize(t *testing.T) {
+	c := newClient(t)
+
+	var result interface{}
+	err := c.call("textDocument/hover", TextDocumentPositionParams{}, &result)
+	if err == nil || err.Code != codeServerNotInitialized {
+		t.Errorf("Found %v, while expecting %d", err, codeServerNotInitialized)
+	}
+
+	var init InitializeResult
+	if err := c.call("initialize", InitializeParams{}, &init); err != nil {
+		t.Fatalf("Found error %v", err)
+	}
+
+	caps := init.Capabilities
+	if caps.TextDocumentSync != SyncFull || !caps.HoverProvider || !caps.DefinitionProvider || !caps.DocumentSymbolProvider {
+		t.Errorf("Found capabilities %+v", caps)
+	}
+
+	if !reflect.DeepEqual(caps.SemanticTokensProvider.Legend.TokenTypes, semanticTypes) {
+		t.Errorf("Found legend %v, while expecting %v", caps.SemanticTokensProvider.Legend.TokenTypes, semanticTypes)
+	}
+
+	err = c.call("unknown/method", nil, &result)
+	if err == nil || err.Code != codeMethodNotFound {
+		t.Errorf("Found %v, while expecting %d", err, codeMethodNotFound)
+	}
+
+	c.shutdown()
+}
+
+func TestPublishDiagnostics(t *testing.T) {
+	c := initialize(t, "let x = 1;\nlet = 5;")
+
+	params := c.diagnostics()
+	if params.URI != testURI || params.Version != 1 {
+		t.Errorf("Found %s version %d, while expecting %s version 1", params.URI, params.Version, testURI)
+	}
+
+	if len(params.Diagnostics) == 0 {
+		t.Fatalf("Found no diagnostics, while expecting an error")
+	}
+
+	d := params.Diagnostics[0]
+	expected := Range{Start: Position{Line: 1, Character: 4}, End: Position{Line: 1, Character: 5}}
+	if d.Range != expected || d.Code != "E201" || d.Severity != SeverityError {
+		t.Errorf("Found %+v, while expecting E201 at %+v", d, expected)
+	}
+
+	if !strings.Contains(d.Message, "hint: ") {
+		t.Errorf("Found message %q, while expecting a hint", d.Message)
+	}
+
+	// Fix the error with a change of the range
+	c.notify("textDocument/didChange", DidChangeTextDocumentParams{
+		TextDocument: VersionedTextDocumentIdentifier{URI: testURI, Version: 2},
+		ContentChanges: []TextDocumentContentChangeEvent{
+			{Range: &Range{Start: Position{Line: 1, Character: 4}, End: Position{Line: 1, Character: 4}}, Text: "y "},
+		},
+	})
+
+	params = c.diagnostics()
+	if params.Version != 2 || len(params.Diagnostics) != 0 {
+		t.Errorf("Found %+v, while expecting no diagnostics", params)
+	}
+
+	// Replace the whole document
+	c.notify("textDocument/didChange", DidChangeTextDocumentParams{
+		TextDocument:   VersionedTextDocumentIdentifier{URI: testURI, Version: 3},
+		ContentChanges: []TextDocumentContentChangeEvent{{Text: `"😀" + `}},
+	})
+
+	params = c.diagnostics()
+	expected = Range{Start: Position{Line: 0, Character: 7}, End: Position{Line: 0, Character: 7}}
+	if len(params.Diagnostics) != 1 || params.Diagnostics[0].Range != expected {
+		t.Errorf("Found %+v, while expecting an error at %+v", params.Diagnostics, expected)
+	}
+
+	c.shutdown()
+}
+
+func TestDocumentSymbol(t *testing.T) {
+	c := initialize(t, testSource)
+	c.diagnostics()
+
+	var symbols []DocumentSymbol
+	if err := c.call("textDocument/documentSymbol", DocumentSymbolParams{TextDocument: TextDocumentIdentifier{URI: testURI}}, &symbols); err != nil {
+		t.Fatalf("Found error %v", err)
+	}
+
+	if len(symbols) != 2 {
+		t.Fatalf("Found %d symbols, while expecting 2: %+v", len(symbols), symbols)
+	}
+
+	add := symbols[0]
+	if add.Name != "add" || add.Kind != SymbolFunction || add.Detail != "fn(x, y)" {
+		t.Errorf("Found %+v, while expecting the function add", add)
+	}
+
+	expected := Range{Start: Position{Line: 0, Character: 0}, End: Position{Line: 3, Character: 1}}
+	if add.Range != expected {
+		t.Errorf("Found range %+v, while expecting %+v", add.Range, expected)
+	}
+
+	if len(add.Children) != 1 || add.Children[0].Name != "sum" || add.Children[0].Kind != SymbolVariable {
+		t.Errorf("Found children %+v, while expecting sum", add.Children)
+	}
+
+	s := symbols[1]
+	expected = Range{Start: Position{Line: 5, Character: 4}, End: Position{Line: 5, Character: 5}}
+	if s.Name != "s" || s.Detail != `"😀"` || s.SelectionRange != expected {
+		t.Errorf("Found %+v, while expecting s at %+v", s, expected)
+	}
+
+	c.shutdown()
+}
+
+// The range of an array ends at its closing bracket
+func TestDocumentSymbolArray(t *testing.T) {
+	c := initialize(t, "let a = [1,\n  [2]]; a[0]")
+	c.diagnostics()
+
+	var symbols []DocumentSymbol
+	if err := c.call("textDocument/documentSymbol", DocumentSymbolParams{TextDocument: TextDocumentIdentifier{URI: testURI}}, &symbols); err != nil {
+		t.Fatalf("Found error %v", err)
+	}
+
+	expected := Range{Start: Position{Line: 0, Character: 0}, End: Position{Line: 1, Character: 6}}
+	if len(symbols) != 1 || symbols[0].Range != expected {
+		t.Errorf("Found %+v, while expecting a at %+v", symbols, expected)
+	}
+
+	c.shutdown()
+}
+
+func TestHoverAndDefinition(t *testing.T) {
+	c := initialize(t, testSource)
+	c.diagnostics()
+
+	tests := []struct {
+		position   Position
+		hover      string
+		definition *Range
+	}{
+		// sum in the body of add
+		{Position{Line: 2, Character: 3}, "let sum = x + y", &Range{Position{1, 6}, Position{1, 9}}},
+		// x in x + y
+		{Position{Line: 1, Character: 12}, "parameter x of fn(x, y)", &Range{Position{0, 13}, Position{0, 14}}},
+		// add after the emoji, which is two UTF-16 units
+		{Position{Line: 5, Character: 14}, "let add = fn(x, y)", &Range{Position{0, 4}, Position{0, 7}}},
+		// s in the call
+		{Position{Line: 5, Character: 18}, `let s = "😀"`, &Range{Position{5, 4}, Position{5, 5}}},
+		// The let keyword
+		{Position{Line: 0, Character: 1}, "", nil},
+	}
+
+	for _, tt := range tests {
+		params := TextDocumentPositionParams{TextDocument: TextDocumentIdentifier{URI: testURI}, Position: tt.position}
+
+		var hover *Hover
+		if err := c.call("textDocument/hover", params, &hover); err != nil {
+			t.Fatalf("Found error %v", err)
+		}
+
+		if tt.hover == "" && hover != nil || tt.hover != "" && (hover == nil || hover.Contents.Value != tt.hover) {
+			t.Errorf("Found hover %+v at %+v, while expecting %q", hover, tt.position, tt.hover)
+		}
+
+		var loc *Location
+		if err := c.call("textDocument/definition", params, &loc); err != nil {
+			t.Fatalf("Found error %v", err)
+		}
+
+		if tt.definition == nil {
+			if loc != nil {
+				t.Errorf("Found definition %+v at %+v, while expecting none", loc, tt.position)
+			}
+			continue
+		}
+
+		if loc == nil || loc.URI != testURI || loc.Range != *tt.definition {
+			t.Errorf("Found definition %+v at %+v, while expecting %+v", loc, tt.position, tt.definition)
+		}
+	}
+
+	c.shutdown()
+}
+
+func TestSemanticTokens(t *testing.T) {
+	c := initialize(t, "let f = fn(a) {\n  a + 1 /* x\ny */\n};\nf(\"😀\")")
+	c.diagnostics()
+
+	var tokens SemanticTokens
+	params := SemanticTokensParams{TextDocument: TextDocumentIdentifier{URI: testURI}}
+	if err := c.call("textDocument/semanticTokens/full", params, &tokens); err != nil {
+		t.Fatalf("Found error %v", err)
+	}
+
+	expected := []int{
+		0, 0, 3, semanticKeyword, 0,
+		0, 4, 1, semanticFunction, 1,
+		0, 2, 1, semanticOperator, 0,
+		0, 2, 2, semanticKeyword, 0,
+		0, 3, 1, semanticParameter, 1,
+		1, 2, 1, semanticParameter, 0,
+		0, 2, 1, semanticOperator, 0,
+		0, 2, 1, semanticNumber, 0,
+		0, 2, 4, semanticComment, 0,
+		1, 0, 4, semanticComment, 0,
+		2, 0, 1, semanticFunction, 0,
+		0, 2, 4, semanticString, 0,
+	}
+
+	if !reflect.DeepEqual(tokens.Data, expected) {
+		t.Errorf("Found %v, while expecting %v", tokens.Data, expected)
+	}
+
+	c.shutdown()
+}
+
+func TestInvalidMessages(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedOutput string
+		expectedError  string
+	}{
+		{"Content-Length: 3\r\n\r\n{x}", `{"jsonrpc":"2.0","id":null,"error":{"code":-32700,`, "closed before a shutdown request"},
+		{"Content-Length: 1099511627776\r\n\r\n", "", "larger than the limit"},
+		{"Content-Length: -1\r\n\r\n", "", "Invalid Content-Length"},
+	}
+
+	for _, tt := range tests {
+		var out strings.Builder
+		err := NewServer(strings.NewReader(tt.input), &out).Serve()
+
+		if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+			t.Errorf("Found error %v, while expecting %q for %q", err, tt.expectedError, tt.input)
+		}
+		if !strings.Contains(out.String(), tt.expectedOutput) || (tt.expectedOutput == "" && out.Len() > 0) {
+			t.Errorf("Found output %q, while expecting %q for %q", out.String(), tt.expectedOutput, tt.input)
+		}
+	}
+}
+
+func TestExitWithoutShutdown(t *testing.T) {
+	c := newClient(t)
+	c.notify("exit", nil)
+
+	if err := <-c.done; err == nil {
+		t.Errorf("Found no error, while expecting an error for exit before shutdown")
+	}
+}
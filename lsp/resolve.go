@@ -0,0 +1,120 @@
+package lsp
+
+import (
+	"github.com/shavit/go-interpreter/ast"
+)
+
+// definition is a name bound by a let statement, or a parameter of a
+//  function
+type definition struct {
+	name *ast.Identifier
+
+	let *ast.LetStatement    // The statement of a let binding
+	fn  *ast.FunctionLiteral // The function of a parameter
+}
+
+// isFunction checks if the name is bound to a function literal
+func (def *definition) isFunction() bool {
+	if def.let == nil {
+		return false
+	}
+
+	_, ok := def.let.Value.(*ast.FunctionLiteral)
+	return ok
+}
+
+// resolution holds the identifiers of a program and their definitions
+type resolution struct {
+	// Every identifier in the program, including the names of the
+	//  definitions
+	identifiers []*ast.Identifier
+
+	// Definitions by identifier, without the identifiers that are not
+	//  defined in the program
+	definitions map[*ast.Identifier]*definition
+}
+
+// scope holds the names defined in a function, or in the program
+// Blocks of if expressions do not have their own scope, like in the
+//  evaluator
+type scope struct {
+	outer *scope
+	names map[string]*definition
+}
+
+// lookup finds a name in the scope, or in its outer scopes
+func (s *scope) lookup(name string) *definition {
+	for ; s != nil; s = s.outer {
+		if def, ok := s.names[name]; ok {
+			return def
+		}
+	}
+
+	return nil
+}
+
+// resolver binds every identifier to the definition that is visible
+//  at its position
+type resolver struct {
+	scope *scope
+	res   *resolution
+}
+
+// resolve finds the definitions of the identifiers of a program
+func resolve(program *ast.Program) resolution {
+	res := resolution{definitions: map[*ast.Identifier]*definition{}}
+	r := &resolver{scope: &scope{names: map[string]*definition{}}, res: &res}
+	ast.Walk(r, program)
+
+	return res
+}
+
+// define adds a definition to the current scope
+func (r *resolver) define(def *definition) {
+	r.res.identifiers = append(r.res.identifiers, def.name)
+	r.res.definitions[def.name] = def
+	r.scope.names[def.name.Value] = def
+}
+
+// Visit binds the identifiers, and opens a new scope for every function
+func (r *resolver) Visit(node ast.Node) ast.Visitor {
+	switch n := node.(type) {
+	case *ast.LetStatement:
+		if n.Name == nil {
+			return r
+		}
+		def := &definition{name: n.Name, let: n}
+
+		// Functions can call themselves, but other values cannot refer
+		//  to their own name
+		if def.isFunction() {
+			r.define(def)
+		}
+		if n.Value != nil {
+			ast.Walk(r, n.Value)
+		}
+		if !def.isFunction() {
+			r.define(def)
+		}
+		return nil
+
+	case *ast.FunctionLiteral:
+		inner := &resolver{scope: &scope{outer: r.scope, names: map[string]*definition{}}, res: r.res}
+		for _, param := range n.Parameters {
+			inner.define(&definition{name: param, fn: n})
+		}
+		if n.Body != nil {
+			ast.Walk(inner, n.Body)
+		}
+		return nil
+
+	case *ast.Identifier:
+		r.res.identifiers = append(r.res.identifiers, n)
+		if def := r.scope.lookup(n.Value); def != nil {
+			r.res.definitions[n] = def
+		}
+		return nil
+	}
+
+	return r
+}
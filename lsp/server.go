@@ -0,0 +1,277 @@
+// Package lsp implements a Language Server Protocol server
+//
+// The server reads JSON-RPC messages from a stream, usually stdin, and
+//  publishes the parser errors of the open documents as diagnostics
+package lsp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Server answers the requests of an editor about the open documents
+type Server struct {
+	conn      *conn
+	documents map[string]*document
+
+	initialized bool
+	shutdown    bool
+}
+
+// handler handles the params of a request or a notification, and
+//  returns the result of requests
+type handler func(s *Server, params json.RawMessage) (interface{}, error)
+
+var handlers = map[string]handler{
+	"initialize":                       (*Server).initialize,
+	"shutdown":                         (*Server).shutdownRequest,
+	"textDocument/didOpen":             (*Server).didOpen,
+	"textDocument/didChange":           (*Server).didChange,
+	"textDocument/didClose":            (*Server).didClose,
+	"textDocument/documentSymbol":      (*Server).documentSymbol,
+	"textDocument/hover":               (*Server).hover,
+	"textDocument/definition":          (*Server).definition,
+	"textDocument/semanticTokens/full": (*Server).semanticTokens,
+}
+
+// errExit stops the server after the exit notification
+var errExit = errors.New("exit")
+
+// NewServer creates a server that reads messages from in, and writes
+//  the responses and notifications to out
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{
+		conn:      newConn(in, out),
+		documents: map[string]*document{},
+	}
+}
+
+// Serve handles the messages until the exit notification
+// It returns an error when the input ends, or the client exits, before
+//  a shutdown request
+func (s *Server) Serve() error {
+	for {
+		msg, err := s.conn.read()
+		if err != nil {
+			var rerr *responseError
+			if errors.As(err, &rerr) {
+				// The message is not valid JSON, so its id is unknown
+				s.conn.reply(nil, nil, rerr)
+				continue
+			}
+
+			if err == io.EOF {
+				if s.shutdown {
+					return nil
+				}
+				return errors.New("The input was closed before a shutdown request")
+			}
+			return err
+		}
+
+		if err := s.handle(msg); err != nil {
+			if err == errExit && s.shutdown {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// handle dispatches a message, and replies to requests
+func (s *Server) handle(msg *message) error {
+	if msg.Method == "exit" {
+		if !s.shutdown {
+			return errors.New("exit before shutdown")
+		}
+		return errExit
+	}
+
+	h, ok := handlers[msg.Method]
+
+	// Notifications never get a response, even when they fail
+	if msg.isNotification() {
+		if ok && s.initialized && !s.shutdown {
+			h(s, msg.Params)
+		}
+		return nil
+	}
+
+	var result interface{}
+	var err error
+
+	switch {
+	case !ok:
+		err = &responseError{Code: codeMethodNotFound, Message: fmt.Sprintf("Method not found: %s", msg.Method)}
+	case !s.initialized && msg.Method != "initialize":
+		err = &responseError{Code: codeServerNotInitialized, Message: "Server not initialized"}
+	case s.shutdown:
+		err = &responseError{Code: codeInvalidRequest, Message: "Server is shutting down"}
+	default:
+		result, err = h(s, msg.Params)
+	}
+
+	return s.conn.reply(msg.ID, result, err)
+}
+
+// decodeParams decodes the params of a message
+func decodeParams(params json.RawMessage, v interface{}) error {
+	if err := json.Unmarshal(params, v); err != nil {
+		return &responseError{Code: codeInvalidParams, Message: err.Error()}
+	}
+
+	return nil
+}
+
+// document returns an open document
+func (s *Server) document(uri string) (*document, error) {
+	d, ok := s.documents[uri]
+	if !ok {
+		return nil, &responseError{Code: codeInvalidParams, Message: fmt.Sprintf("Unknown document %s", uri)}
+	}
+
+	return d, nil
+}
+
+// publishDiagnostics sends the errors of a document
+func (s *Server) publishDiagnostics(d *document) error {
+	return s.conn.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{
+		URI:         d.uri,
+		Version:     d.version,
+		Diagnostics: d.diagnostics(),
+	})
+}
+
+func (s *Server) initialize(params json.RawMessage) (interface{}, error) {
+	var p InitializeParams
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	s.initialized = true
+
+	return InitializeResult{
+		Capabilities: ServerCapabilities{
+			TextDocumentSync:       SyncFull,
+			HoverProvider:          true,
+			DefinitionProvider:     true,
+			DocumentSymbolProvider: true,
+			SemanticTokensProvider: SemanticTokensProvider{
+				Legend: SemanticTokensLegend{
+					TokenTypes:     semanticTypes,
+					TokenModifiers: semanticModifiers,
+				},
+				Full: true,
+			},
+		},
+		ServerInfo: ServerInfo{Name: "go-interpreter"},
+	}, nil
+}
+
+func (s *Server) shutdownRequest(params json.RawMessage) (interface{}, error) {
+	s.shutdown = true
+	return nil, nil
+}
+
+func (s *Server) didOpen(params json.RawMessage) (interface{}, error) {
+	var p DidOpenTextDocumentParams
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+
+	d := newDocument(p.TextDocument.URI, p.TextDocument.Version, p.TextDocument.Text)
+	s.documents[d.uri] = d
+
+	return nil, s.publishDiagnostics(d)
+}
+
+// didChange applies the changes in order, and parses the new text
+func (s *Server) didChange(params json.RawMessage) (interface{}, error) {
+	var p DidChangeTextDocumentParams
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+
+	d, err := s.document(p.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, change := range p.ContentChanges {
+		d = newDocument(d.uri, p.TextDocument.Version, d.applyChange(change))
+	}
+	s.documents[d.uri] = d
+
+	return nil, s.publishDiagnostics(d)
+}
+
+func (s *Server) didClose(params json.RawMessage) (interface{}, error) {
+	var p DidCloseTextDocumentParams
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	delete(s.documents, p.TextDocument.URI)
+
+	// Clear the diagnostics of the closed document
+	return nil, s.conn.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{
+		URI:         p.TextDocument.URI,
+		Diagnostics: []Diagnostic{},
+	})
+}
+
+func (s *Server) documentSymbol(params json.RawMessage) (interface{}, error) {
+	var p DocumentSymbolParams
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+
+	d, err := s.document(p.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+
+	return d.symbols(d.program), nil
+}
+
+func (s *Server) hover(params json.RawMessage) (interface{}, error) {
+	var p TextDocumentPositionParams
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+
+	d, err := s.document(p.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+
+	return d.hover(p.Position), nil
+}
+
+func (s *Server) definition(params json.RawMessage) (interface{}, error) {
+	var p TextDocumentPositionParams
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+
+	d, err := s.document(p.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+
+	return d.definition(p.Position), nil
+}
+
+func (s *Server) semanticTokens(params json.RawMessage) (interface{}, error) {
+	var p SemanticTokensParams
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+
+	d, err := s.document(p.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+
+	return d.semanticTokens(), nil
+}
@@ -1,23 +1,438 @@
 package main
 
 import (
+	"encoding/json"
+	"flag"
 	"fmt"
+	"io"
 	"os"
-	"os/user"
 
+	"github.com/shavit/go-interpreter/ast"
+	"github.com/shavit/go-interpreter/compiler"
+	"github.com/shavit/go-interpreter/diagnostic"
+	"github.com/shavit/go-interpreter/evaluator"
+	"github.com/shavit/go-interpreter/format"
+	"github.com/shavit/go-interpreter/lexer"
+	"github.com/shavit/go-interpreter/lsp"
+	"github.com/shavit/go-interpreter/object"
+	"github.com/shavit/go-interpreter/parser"
 	"github.com/shavit/go-interpreter/repl"
+	"github.com/shavit/go-interpreter/token"
+	"github.com/shavit/go-interpreter/vm"
 )
 
-func checkErr(err error) {
+const name = "go-interpreter"
+
+// Exit codes
+const (
+	exitOK    = 0
+	exitError = 1 // Lex, parse or runtime errors
+	exitUsage = 2
+)
+
+const usage = `Usage:
+  %[1]s [flags] [command] [arguments]
+
+Commands:
+  run <file>     evaluate a script, use - for stdin
+  tokens <file>  print the tokens of a script
+  parse <file>   print the syntax tree of a script, -json for JSON
+  fmt [-w] [-d] [files]
+                 format scripts, -w writes them, -d prints a diff
+  lsp            start a language server on stdin and stdout
+  repl           start the interactive interpreter (default)
+
+Flags:
+`
+
+// cli holds the streams of a command, so commands can run in tests
+type cli struct {
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+
+	// interactive is set when stdin is a terminal
+	interactive bool
+
+	// engine runs the scripts, either the evaluator or the vm
+	engine string
+}
+
+// Engines that run scripts
+const (
+	engineAST = "ast"
+	engineVM  = "vm"
+)
+
+// command runs a subcommand with its arguments, and returns the exit code
+type command func(c *cli, args []string) int
+
+var commands = map[string]command{
+	"run":    runCommand,
+	"tokens": tokensCommand,
+	"parse":  parseCommand,
+	"fmt":    fmtCommand,
+	"lsp":    lspCommand,
+	"repl":   replCommand,
+}
+
+func main() {
+	c := &cli{
+		stdin:       os.Stdin,
+		stdout:      os.Stdout,
+		stderr:      os.Stderr,
+		interactive: isTerminal(os.Stdin),
+	}
+
+	os.Exit(c.run(os.Args[1:]))
+}
+
+// isTerminal checks if the file is a character device, and not a pipe
+//  or a regular file
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
 	if err != nil {
-		panic(err)
+		return false
 	}
+
+	return info.Mode()&os.ModeCharDevice != 0
 }
 
-func main() {
-	user, err := user.Current()
-	checkErr(err)
+// run parses the global flags and dispatches to the subcommand
+func (c *cli) run(args []string) int {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(c.stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(c.stderr, usage, name)
+		fs.PrintDefaults()
+	}
+	expr := fs.String("e", "", "evaluate an expression and print the result")
+	fs.StringVar(&c.engine, "engine", engineAST, "run scripts with the ast evaluator, or the bytecode vm")
+
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
+		}
+		return exitUsage
+	}
+
+	if c.engine != engineAST && c.engine != engineVM {
+		fmt.Fprintf(c.stderr, "%s: unknown engine %q, use %s or %s\n", name, c.engine, engineAST, engineVM)
+		return exitUsage
+	}
+
+	exprSet := false
+	fs.Visit(func(f *flag.Flag) {
+		exprSet = exprSet || f.Name == "e"
+	})
+
+	if exprSet {
+		if fs.NArg() > 0 {
+			fmt.Fprintf(c.stderr, "%s: -e does not accept a command\n", name)
+			return exitUsage
+		}
+		return c.eval("-e", *expr)
+	}
+
+	if fs.NArg() == 0 {
+		return replCommand(c, nil)
+	}
+
+	cmd, ok := commands[fs.Arg(0)]
+	if !ok {
+		fmt.Fprintf(c.stderr, "%s: unknown command %q\n", name, fs.Arg(0))
+		fs.Usage()
+		return exitUsage
+	}
+
+	return cmd(c, fs.Args()[1:])
+}
+
+// readSource reads a script from a file, or from stdin for -
+func (c *cli) readSource(filename string) (string, error) {
+	if filename == "-" {
+		b, err := io.ReadAll(c.stdin)
+		return string(b), err
+	}
+
+	b, err := os.ReadFile(filename)
+	return string(b), err
+}
+
+// fileArgument returns the only argument of a command
+func (c *cli) fileArgument(cmd string, args []string) (string, bool) {
+	if len(args) != 1 {
+		fmt.Fprintf(c.stderr, "%s: usage: %s %s <file>\n", name, name, cmd)
+		return "", false
+	}
+
+	return args[0], true
+}
+
+// parse parses a script and prints the diagnostics
+func (c *cli) parse(filename, src string) (*ast.Program, bool) {
+	p := parser.New(lexer.NewFile(filename, src))
+	program := p.ParseProgram()
+
+	if errors := p.Errors(); len(errors) > 0 {
+		for _, d := range errors {
+			diagnostic.Render(c.stderr, src, d)
+		}
+		return nil, false
+	}
+
+	return program, true
+}
+
+// eval evaluates a script with the engine, and prints its result unless
+//  it is null
+func (c *cli) eval(filename, src string) int {
+	program, ok := c.parse(filename, src)
+	if !ok {
+		return exitError
+	}
+
+	var result object.Object
+	if c.engine == engineVM {
+		var err error
+		if result, err = runVM(program); err != nil {
+			fmt.Fprintf(c.stderr, "%s: Error: %v\n", filename, err)
+			return exitError
+		}
+	} else {
+		result = evaluator.Eval(program, object.NewEnvironment())
+	}
+
+	if result == nil {
+		return exitOK
+	}
+
+	if result.Type() == object.ERROR_OBJ {
+		fmt.Fprintf(c.stderr, "%s: %s\n", filename, result.Inspect())
+		return exitError
+	}
+
+	if result.Type() != object.NULL_OBJ {
+		fmt.Fprintln(c.stdout, result.Inspect())
+	}
+
+	return exitOK
+}
+
+// runVM compiles a program to bytecode, and runs it in the vm
+// Compile errors are returned like runtime errors
+func runVM(program *ast.Program) (object.Object, error) {
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		return nil, err
+	}
+
+	machine := vm.New(comp.Bytecode())
+	if err := machine.Run(); err != nil {
+		return nil, err
+	}
+
+	return machine.Result(), nil
+}
+
+// runCommand evaluates a script file
+func runCommand(c *cli, args []string) int {
+	filename, ok := c.fileArgument("run", args)
+	if !ok {
+		return exitUsage
+	}
+
+	src, err := c.readSource(filename)
+	if err != nil {
+		fmt.Fprintf(c.stderr, "%s: %v\n", name, err)
+		return exitError
+	}
+
+	return c.eval(filename, src)
+}
+
+// tokensCommand prints the tokens of a script, one per line
+// The file is lexed while it is read, so large files and pipes are not
+//  loaded into memory
+func tokensCommand(c *cli, args []string) int {
+	filename, ok := c.fileArgument("tokens", args)
+	if !ok {
+		return exitUsage
+	}
+
+	in := c.stdin
+	if filename != "-" {
+		f, err := os.Open(filename)
+		if err != nil {
+			fmt.Fprintf(c.stderr, "%s: %v\n", name, err)
+			return exitError
+		}
+		defer f.Close()
+		in = f
+	}
+
+	l := lexer.NewReader(filename, in)
+	for tkn := l.NextToken(); tkn.Type != token.EOF; tkn = l.NextToken() {
+		fmt.Fprintf(c.stdout, "%s\t%s\t%q\n", tkn.Pos, tkn.Type, tkn.Literal)
+	}
+
+	if errors := l.Errors(); len(errors) > 0 {
+		for _, d := range errors {
+			fmt.Fprintln(c.stderr, d.Error())
+		}
+		return exitError
+	}
+
+	return exitOK
+}
+
+// parseCommand prints the syntax tree of a script, one statement per line
+// With -json the tree is printed as JSON, that can be decoded with
+//  ast.UnmarshalJSON
+func parseCommand(c *cli, args []string) int {
+	fs := flag.NewFlagSet("parse", flag.ContinueOnError)
+	fs.SetOutput(c.stderr)
+	asJSON := fs.Bool("json", false, "print the syntax tree as JSON")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	filename, ok := c.fileArgument("parse", fs.Args())
+	if !ok {
+		return exitUsage
+	}
+
+	src, err := c.readSource(filename)
+	if err != nil {
+		fmt.Fprintf(c.stderr, "%s: %v\n", name, err)
+		return exitError
+	}
+
+	program, ok := c.parse(filename, src)
+	if !ok {
+		return exitError
+	}
+
+	if *asJSON {
+		b, err := json.MarshalIndent(program, "", "  ")
+		if err != nil {
+			fmt.Fprintf(c.stderr, "%s: %v\n", name, err)
+			return exitError
+		}
+		fmt.Fprintln(c.stdout, string(b))
+		return exitOK
+	}
+
+	for _, stmt := range program.Statements {
+		fmt.Fprintln(c.stdout, stmt.String())
+	}
+
+	return exitOK
+}
+
+// fmtCommand formats scripts in the canonical style
+// The formatted scripts are printed, unless -w writes them back or -d
+//  prints the changes. Without files, it formats stdin
+func fmtCommand(c *cli, args []string) int {
+	fs := flag.NewFlagSet("fmt", flag.ContinueOnError)
+	fs.SetOutput(c.stderr)
+	write := fs.Bool("w", false, "write the result to the file, instead of stdout")
+	showDiff := fs.Bool("d", false, "print a diff, instead of the formatted script")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	files := fs.Args()
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+
+	code := exitOK
+	for _, filename := range files {
+		if filename == "-" && *write {
+			fmt.Fprintf(c.stderr, "%s: cannot use -w with stdin\n", name)
+			return exitUsage
+		}
+
+		if !c.formatFile(filename, *write, *showDiff) {
+			code = exitError
+		}
+	}
+
+	return code
+}
+
+// formatFile formats a single script, and reports its errors
+func (c *cli) formatFile(filename string, write, showDiff bool) bool {
+	src, err := c.readSource(filename)
+	if err != nil {
+		fmt.Fprintf(c.stderr, "%s: %v\n", name, err)
+		return false
+	}
+
+	out, errors := format.Source(filename, []byte(src))
+	if len(errors) > 0 {
+		for _, d := range errors {
+			diagnostic.Render(c.stderr, src, d)
+		}
+		return false
+	}
+
+	if showDiff {
+		fmt.Fprint(c.stdout, diff(filename, src, string(out)))
+	} else if !write {
+		c.stdout.Write(out)
+	}
+
+	if write && string(out) != src {
+		if err := os.WriteFile(filename, out, 0644); err != nil {
+			fmt.Fprintf(c.stderr, "%s: %v\n", name, err)
+			return false
+		}
+	}
+
+	return true
+}
+
+// lspCommand serves the Language Server Protocol, for editors
+func lspCommand(c *cli, args []string) int {
+	if len(args) > 0 {
+		fmt.Fprintf(c.stderr, "%s: usage: %s lsp\n", name, name)
+		return exitUsage
+	}
+
+	if err := lsp.NewServer(c.stdin, c.stdout).Serve(); err != nil {
+		fmt.Fprintf(c.stderr, "%s: %v\n", name, err)
+		return exitError
+	}
+
+	return exitOK
+}
+
+// replCommand starts the interactive interpreter
+// The banner is only printed for terminals, so the output of piped input
+//  stays clean
+func replCommand(c *cli, args []string) int {
+	if len(args) > 0 {
+		fmt.Fprintf(c.stderr, "%s: usage: %s repl\n", name, name)
+		return exitUsage
+	}
+
+	if c.interactive {
+		fmt.Fprintf(c.stdout, "   ____ PROGRAMMING LANGUAGE\n\n %s, press Ctrl+C to exit\n", username())
+	}
+
+	repl.Start(c.stdin, c.stdout)
+
+	return exitOK
+}
+
+// username returns the name of the current user from the environment
+// It does not use os/user, which fails in some containers
+func username() string {
+	if u := os.Getenv("USER"); u != "" {
+		return u
+	}
 
-	fmt.Println("   ____ PROGRAMMING LANGUAGE\n\n", user.Username, ", press Ctrl+C to exit")
-	repl.Start(os.Stdin, os.Stdout)
+	return "Hello"
 }
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func testCLI(t *testing.T, stdin string, args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	c := &cli{
+		stdin:  strings.NewReader(stdin),
+		stdout: &stdout,
+		stderr: &stderr,
+	}
+
+	code := c.run(args)
+
+	return code, stdout.String(), stderr.String()
+}
+
+func writeScript(t *testing.T, src string) string {
+	filename := filepath.Join(t.TempDir(), "script.mk")
+	if err := os.WriteFile(filename, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return filename
+}
+
+// lspMessages frames JSON-RPC messages for the lsp command
+func lspMessages(messages ...string) string {
+	var buf strings.Builder
+	for _, m := range messages {
+		fmt.Fprintf(&buf, "Content-Length: %d\r\n\r\n%s", len(m), m)
+	}
+
+	return buf.String()
+}
+
+func TestCLI(t *testing.T) {
+	session := lspMessages(
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`,
+		`{"jsonrpc":"2.0","id":2,"method":"shutdown"}`,
+		`{"jsonrpc":"2.0","method":"exit"}`,
+	)
+
+	script := writeScript(t, "let add = fn(x, y) { x + y };\nadd(2, 3) * 2")
+	broken := writeScript(t, "let = 5;")
+
+	tests := []struct {
+		args           []string
+		stdin          string
+		expectedCode   int
+		expectedStdout string
+		expectedStderr string
+	}{
+		{[]string{"-e", "1 + 2 * 3"}, "", exitOK, "7\n", ""},
+		{[]string{"-e", "let x = 1"}, "", exitOK, "", ""},
+		{[]string{"-e", "1 +"}, "", exitError, "", "-e:1:4: error[E204]"},
+		{[]string{"-e", "1 + true"}, "", exitError, "", "Type mismatch: INTEGER + BOOLEAN"},
+		{[]string{"run", script}, "", exitOK, "10\n", ""},
+		{[]string{"--engine=vm", "run", script}, "", exitOK, "10\n", ""},
+		{[]string{"--engine=vm", "-e", "let x = 1"}, "", exitOK, "", ""},
+		{[]string{"--engine=vm", "-e", "1 + true"}, "", exitError, "", "-e: Error: Type mismatch: INTEGER + BOOLEAN"},
+		{[]string{"--engine=vm", "-e", "missing"}, "", exitError, "", "-e: Error: Identifier not found: missing"},
+		{[]string{"--engine=jit", "-e", "1"}, "", exitUsage, "", `unknown engine "jit"`},
+		{[]string{"run", "-"}, "-(4 * 2)", exitOK, "-8\n", ""},
+		{[]string{"run", broken}, "", exitError, "", "error[E201]: Found =, while expecting the next token to be IDENT"},
+		{[]string{"run", "missing.mk"}, "", exitError, "", "no such file"},
+		{[]string{"run"}, "", exitUsage, "", "usage"},
+		{[]string{"parse", script}, "", exitOK, "let add = fn(x, y) { (x + y) };\n(add(2, 3) * 2)\n", ""},
+		{[]string{"parse", "-json", "-"}, "x", exitOK, `"kind": "ExpressionStatement"`, ""},
+		{[]string{"tokens", "-"}, "let x", exitOK, "-:1:1\tLET\t\"let\"\n-:1:5\tIDENT\t\"x\"\n", ""},
+		{[]string{"tokens", "-"}, "x @", exitError, "IDENT", "-:1:3: error[E101]"},
+		{[]string{"fmt"}, "let x=1", exitOK, "let x = 1;\n", ""},
+		{[]string{"fmt", "-d", "-"}, "let x=1\n", exitOK, "@@ -1,1 +1,1 @@\n-let x=1\n+let x = 1;\n", ""},
+		{[]string{"fmt", "-d", "-"}, "let x = 1;\n", exitOK, "", ""},
+		{[]string{"fmt", "-"}, "let = 1", exitError, "", "error[E201]"},
+		{[]string{"fmt", "-w"}, "let x=1", exitUsage, "", "cannot use -w with stdin"},
+		{[]string{"lsp"}, session, exitOK, `{"jsonrpc":"2.0","id":2,"result":null}`, ""},
+		{[]string{"lsp"}, "", exitError, "", "closed before a shutdown request"},
+		{[]string{"repl"}, "let x = 1\nx + 1\n", exitOK, ">> >> 2\n>> ", ""},
+		{[]string{"unknown"}, "", exitUsage, "", `unknown command "unknown"`},
+	}
+
+	for _, tt := range tests {
+		code, stdout, stderr := testCLI(t, tt.stdin, tt.args...)
+
+		if code != tt.expectedCode {
+			t.Errorf("Found exit code %d, while expecting %d for %q: %s", code, tt.expectedCode, tt.args, stderr)
+		}
+
+		if !strings.Contains(stdout, tt.expectedStdout) || (tt.expectedStdout == "" && stdout != "") {
+			t.Errorf("Found stdout %q, while expecting %q for %q", stdout, tt.expectedStdout, tt.args)
+		}
+
+		if !strings.Contains(stderr, tt.expectedStderr) || (tt.expectedStderr == "" && stderr != "") {
+			t.Errorf("Found stderr %q, while expecting %q for %q", stderr, tt.expectedStderr, tt.args)
+		}
+	}
+}
+
+func TestFmtWrite(t *testing.T) {
+	script := writeScript(t, "let add=fn(x,y){x+y}")
+
+	code, stdout, stderr := testCLI(t, "", "fmt", "-w", script)
+	if code != exitOK || stdout != "" || stderr != "" {
+		t.Fatalf("Found exit code %d, stdout %q and stderr %q, while expecting no output", code, stdout, stderr)
+	}
+
+	b, err := os.ReadFile(script)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "let add = fn(x, y) {\n\tx + y;\n};\n"
+	if string(b) != expected {
+		t.Errorf("Found %q, while expecting %q", b, expected)
+	}
+}
+
+// The edits rebuild both versions, with the fewest changed lines
+func TestDiffLines(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	random := func() []string {
+		lines := make([]string, r.Intn(12))
+		for i := range lines {
+			lines[i] = strconv.Itoa(r.Intn(4))
+		}
+		return lines
+	}
+
+	for n := 0; n < 500; n++ {
+		a, b := random(), random()
+		edits := diffLines(a, b)
+
+		var gotA, gotB []string
+		changes := 0
+		for _, e := range edits {
+			if e.op != '+' {
+				gotA = append(gotA, e.line)
+			}
+			if e.op != '-' {
+				gotB = append(gotB, e.line)
+			}
+			if e.op != ' ' {
+				changes += 1
+			}
+		}
+
+		if strings.Join(gotA, "\n") != strings.Join(a, "\n") || strings.Join(gotB, "\n") != strings.Join(b, "\n") {
+			t.Fatalf("Found edits %v, while expecting them to rebuild %v and %v", edits, a, b)
+		}
+		if expected := len(a) + len(b) - 2*lcsLength(a, b); changes != expected {
+			t.Fatalf("Found %d changes, while expecting %d for %v and %v", changes, expected, a, b)
+		}
+	}
+}
+
+// lcsLength returns the length of the longest common subsequence
+func lcsLength(a, b []string) int {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	return lcs[0][0]
+}
+
+// Large files are compared without a table of every pair of lines
+func TestDiffLargeFiles(t *testing.T) {
+	lines := make([]string, 20000)
+	changed := make([]string, len(lines))
+	for i := range lines {
+		lines[i] = fmt.Sprintf("let x%d = %d;", i, i)
+		changed[i] = fmt.Sprintf("let y%d = %d;", i, i)
+	}
+
+	a := strings.Join(lines, "\n") + "\n"
+	lines[100] = "let changed = 1;"
+	lines[15000] = "let changed = 2;"
+	b := strings.Join(lines, "\n") + "\n"
+
+	out := diff("x", a, b)
+	if strings.Count(out, "@@ -") != 2 || !strings.Contains(out, "-let x100 = 100;\n+let changed = 1;\n") {
+		t.Errorf("Found %q, while expecting two hunks", out)
+	}
+
+	// Every line changed, so the file is replaced as a whole
+	out = diff("x", a, strings.Join(changed, "\n")+"\n")
+	if !strings.HasPrefix(out, "--- x.orig\n+++ x\n@@ -1,20000 +1,20000 @@\n-let x0 = 0;\n") {
+		t.Errorf("Found %q, while expecting the whole file to be replaced", out[:min(len(out), 200)])
+	}
+}
+
+func TestDiff(t *testing.T) {
+	a := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n14\n"
+	b := "1\n2\n3\n4\nfive\n6\n7\n8\n9\n10\n11\n12\n13\n"
+
+	expected := `--- x.orig
++++ x
+@@ -2,7 +2,7 @@
+ 2
+ 3
+ 4
+-5
++five
+ 6
+ 7
+ 8
+@@ -11,4 +11,3 @@
+ 11
+ 12
+ 13
+-14
+`
+
+	if out := diff("x", a, b); out != expected {
+		t.Errorf("Found %q, while expecting %q", out, expected)
+	}
+
+	if out := diff("x", a, a); out != "" {
+		t.Errorf("Found %q, while expecting no diff", out)
+	}
+}
@@ -0,0 +1,74 @@
+package object
+
+import (
+	"sort"
+)
+
+// Environment holds the bindings created by let statements
+// Function calls create an enclosed environment, that falls back to
+//  the outer environment for names it does not bind
+type Environment struct {
+	store map[string]Object
+	outer *Environment
+
+	// The number of function calls that are running
+	depth int
+}
+
+// NewEnvironment creates a new empty environment
+func NewEnvironment() *Environment {
+	return &Environment{
+		store: make(map[string]Object),
+	}
+}
+
+// NewEnclosedEnvironment creates a new environment inside another one
+func NewEnclosedEnvironment(outer *Environment) *Environment {
+	env := NewEnvironment()
+	env.outer = outer
+
+	return env
+}
+
+// NewCallEnvironment creates the environment of a function call
+// It is enclosed by the environment of the function, and is one call
+//  deeper than the environment of the caller
+func NewCallEnvironment(outer, caller *Environment) *Environment {
+	env := NewEnclosedEnvironment(outer)
+	env.depth = caller.depth + 1
+
+	return env
+}
+
+// Depth returns the number of function calls that are running
+func (e *Environment) Depth() int {
+	return e.depth
+}
+
+// Get returns the object bound to a name
+func (e *Environment) Get(name string) (Object, bool) {
+	obj, ok := e.store[name]
+	if !ok && e.outer != nil {
+		obj, ok = e.outer.Get(name)
+	}
+
+	return obj, ok
+}
+
+// Set binds an object to a name
+func (e *Environment) Set(name string, val Object) Object {
+	e.store[name] = val
+	return val
+}
+
+// Names returns the names bound in this environment, without the outer
+//  environments, sorted
+func (e *Environment) Names() []string {
+	names := make([]string, 0, len(e.store))
+	for name := range e.store {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
@@ -0,0 +1,324 @@
+package object
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/shavit/go-interpreter/ast"
+	"github.com/shavit/go-interpreter/code"
+	"github.com/shavit/go-interpreter/token"
+)
+
+type ObjectType string
+
+const (
+	INTEGER_OBJ      = "INTEGER"
+	FLOAT_OBJ        = "FLOAT"
+	STRING_OBJ       = "STRING"
+	BOOLEAN_OBJ      = "BOOLEAN"
+	NULL_OBJ         = "NULL"
+	RETURN_VALUE_OBJ = "RETURN_VALUE"
+	ERROR_OBJ        = "ERROR"
+	FUNCTION_OBJ     = "FUNCTION"
+	ARRAY_OBJ        = "ARRAY"
+	HASH_OBJ         = "HASH"
+
+	COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION"
+)
+
+// Object is the value produced by evaluating a node
+type Object interface {
+	// Type returns the type of the object
+	Type() ObjectType
+
+	// Inspect returns a string representation of the value
+	Inspect() string
+}
+
+// Integer wraps an int64 value
+type Integer struct {
+	Value int64
+}
+
+// Type returns the integer object type
+func (i *Integer) Type() ObjectType {
+	return INTEGER_OBJ
+}
+
+// Inspect returns the integer value as a string
+func (i *Integer) Inspect() string {
+	return fmt.Sprintf("%d", i.Value)
+}
+
+// HashKey returns the integer value as the key
+func (i *Integer) HashKey() HashKey {
+	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
+}
+
+// Float wraps a float64 value
+type Float struct {
+	Value float64
+}
+
+// Type returns the float object type
+func (f *Float) Type() ObjectType {
+	return FLOAT_OBJ
+}
+
+// Inspect returns the float value as a float literal
+func (f *Float) Inspect() string {
+	return token.FormatFloat(f.Value)
+}
+
+// String wraps a string value
+type String struct {
+	Value string
+}
+
+// Type returns the string object type
+func (s *String) Type() ObjectType {
+	return STRING_OBJ
+}
+
+// Inspect returns the string value without quotes
+func (s *String) Inspect() string {
+	return s.Value
+}
+
+// HashKey returns the string itself as the key, so different strings
+//  are always different keys
+func (s *String) HashKey() HashKey {
+	return HashKey{Type: s.Type(), Text: s.Value}
+}
+
+// Array is an ordered list of values
+type Array struct {
+	Elements []Object
+}
+
+// Type returns the array object type
+func (a *Array) Type() ObjectType {
+	return ARRAY_OBJ
+}
+
+// Inspect returns the elements between brackets
+func (a *Array) Inspect() string {
+	elements := []string{}
+	for _, el := range a.Elements {
+		elements = append(elements, el.Inspect())
+	}
+
+	return "[" + strings.Join(elements, ", ") + "]"
+}
+
+// HashKey identifies a key of a hash
+// Keys of different types are different, even if their values are the
+//  same. Strings use the text, and the other types use the value
+type HashKey struct {
+	Type  ObjectType
+	Value uint64
+	Text  string
+}
+
+// Hashable is implemented by the objects that can be used as hash keys
+type Hashable interface {
+	Object
+	HashKey() HashKey
+}
+
+// HashPair is a key and its value in a hash
+type HashPair struct {
+	Key   Object
+	Value Object
+}
+
+// Hash maps keys to values
+// The keys are kept in the order they were added, so hashes are
+//  printed the same way every time
+type Hash struct {
+	Pairs map[HashKey]HashPair
+	Keys  []HashKey
+}
+
+// NewHash creates an empty hash
+func NewHash() *Hash {
+	return &Hash{Pairs: map[HashKey]HashPair{}}
+}
+
+// Set adds a pair, or replaces the value of an existing key
+func (h *Hash) Set(key Hashable, value Object) {
+	hashKey := key.HashKey()
+	if _, ok := h.Pairs[hashKey]; !ok {
+		h.Keys = append(h.Keys, hashKey)
+	}
+
+	h.Pairs[hashKey] = HashPair{Key: key, Value: value}
+}
+
+// Get returns the value of a key
+func (h *Hash) Get(key Hashable) (Object, bool) {
+	pair, ok := h.Pairs[key.HashKey()]
+	return pair.Value, ok
+}
+
+// Type returns the hash object type
+func (h *Hash) Type() ObjectType {
+	return HASH_OBJ
+}
+
+// Inspect returns the pairs between braces
+func (h *Hash) Inspect() string {
+	pairs := []string{}
+	for _, key := range h.Keys {
+		pair := h.Pairs[key]
+		pairs = append(pairs, pair.Key.Inspect()+": "+pair.Value.Inspect())
+	}
+
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
+
+// Boolean wraps a bool value
+type Boolean struct {
+	Value bool
+}
+
+// Type returns the boolean object type
+func (b *Boolean) Type() ObjectType {
+	return BOOLEAN_OBJ
+}
+
+// Inspect returns the boolean value as a string
+func (b *Boolean) Inspect() string {
+	return fmt.Sprintf("%t", b.Value)
+}
+
+// HashKey returns 1 for true and 0 for false as the key
+func (b *Boolean) HashKey() HashKey {
+	var value uint64
+	if b.Value {
+		value = 1
+	}
+
+	return HashKey{Type: b.Type(), Value: value}
+}
+
+// Null represents the absence of a value
+type Null struct{}
+
+// Type returns the null object type
+func (n *Null) Type() ObjectType {
+	return NULL_OBJ
+}
+
+// Inspect returns the null string representation
+func (n *Null) Inspect() string {
+	return "null"
+}
+
+// ReturnValue wraps the value of a return statement, so the evaluator
+//  can stop evaluating the rest of the statements
+type ReturnValue struct {
+	Value Object
+}
+
+// Type returns the return value object type
+func (rv *ReturnValue) Type() ObjectType {
+	return RETURN_VALUE_OBJ
+}
+
+// Inspect returns the string representation of the wrapped value
+func (rv *ReturnValue) Inspect() string {
+	return rv.Value.Inspect()
+}
+
+// Error is a runtime error. It stops the evaluation like a return
+//  statement
+type Error struct {
+	Message string
+}
+
+// Type returns the error object type
+func (e *Error) Type() ObjectType {
+	return ERROR_OBJ
+}
+
+// Inspect returns the error message
+func (e *Error) Inspect() string {
+	return "Error: " + e.Message
+}
+
+// Function is a function literal along with the environment it was
+//  created in, so it can access the bindings around it
+type Function struct {
+	Parameters []*ast.Identifier
+	Body       *ast.BlockStatement
+	Env        *Environment
+}
+
+// Type returns the function object type
+func (f *Function) Type() ObjectType {
+	return FUNCTION_OBJ
+}
+
+// Inspect returns the source of the function
+func (f *Function) Inspect() string {
+	var out bytes.Buffer
+
+	params := []string{}
+	for _, p := range f.Parameters {
+		params = append(params, p.String())
+	}
+
+	out.WriteString("fn(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") ")
+	out.WriteString(f.Body.String())
+
+	return out.String()
+}
+
+// CompiledFunction is the bytecode of a function literal
+type CompiledFunction struct {
+	Instructions  code.Instructions
+	NumLocals     int
+	NumParameters int
+
+	// The names of the locals, by slot
+	LocalNames []string
+
+	// The function literal, so the function prints like in the evaluator
+	Literal *ast.FunctionLiteral
+}
+
+// Type returns the compiled function object type
+func (cf *CompiledFunction) Type() ObjectType {
+	return COMPILED_FUNCTION_OBJ
+}
+
+// Inspect returns the source of the function
+func (cf *CompiledFunction) Inspect() string {
+	if cf.Literal == nil {
+		return fmt.Sprintf("CompiledFunction[%p]", cf)
+	}
+
+	return cf.Literal.String()
+}
+
+// Closure is a compiled function along with the free variables it
+//  captured when it was created
+type Closure struct {
+	Fn   *CompiledFunction
+	Free []Object
+}
+
+// Type returns the function object type, since closures are the
+//  functions of the virtual machine
+func (c *Closure) Type() ObjectType {
+	return FUNCTION_OBJ
+}
+
+// Inspect returns the source of the function
+func (c *Closure) Inspect() string {
+	return c.Fn.Inspect()
+}
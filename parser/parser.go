@@ -5,6 +5,7 @@ import (
 	"strconv"
 
 	"github.com/shavit/go-interpreter/ast"
+	"github.com/shavit/go-interpreter/diagnostic"
 	"github.com/shavit/go-interpreter/lexer"
 	"github.com/shavit/go-interpreter/token"
 )
@@ -14,15 +15,20 @@ import (
 const (
 	_ int = iota
 	LOWEST
+	OR          // ||
+	AND         // &&
 	EQUALS      // ==
 	LESSGREATER // > or <
 	SUM         // +
 	PRODUCT     // *
 	PREFIX      // -x or !x
 	CALL        // someFunc(x)
+	INDEX       // array[index]
 )
 
 var precedences = map[token.TokenType]int{
+	token.OR:       OR,
+	token.AND:      AND,
 	token.EQ:       EQUALS,
 	token.NOT_EQ:   EQUALS,
 	token.LT:       LESSGREATER,
@@ -31,6 +37,41 @@ var precedences = map[token.TokenType]int{
 	token.MINUS:    SUM,
 	token.SLASH:    PRODUCT,
 	token.ASTERISK: PRODUCT,
+	token.LPAREN:   CALL,
+	token.LBRACKET: INDEX,
+}
+
+// MaxErrors is the number of errors after which the parser stops, so
+//  the first errors are not buried under the errors they cause
+const MaxErrors = 10
+
+// Tokens that start a statement, where the parser can resume after an
+//  error
+var statementStart = map[token.TokenType]bool{
+	token.LET:    true,
+	token.RETURN: true,
+}
+
+// Tokens that close an expression or a block, or separate expressions
+var closingTokens = map[token.TokenType]bool{
+	token.RPAREN:    true,
+	token.RBRACE:    true,
+	token.RBRACKET:  true,
+	token.SEMICOLON: true,
+	token.COMMA:     true,
+	token.COLON:     true,
+}
+
+// Precedence returns the precedence of an infix operator, or LOWEST
+//  for tokens that are not operators
+// Tools like the formatter use it to decide where parentheses are
+//  needed
+func Precedence(t token.TokenType) int {
+	if p, ok := precedences[t]; ok {
+		return p
+	}
+
+	return LOWEST
 }
 
 //
@@ -41,10 +82,31 @@ var precedences = map[token.TokenType]int{
 type Parser struct {
 	l *lexer.Lexer
 
+	prevToken    token.Token
 	currentToken token.Token
 	peekToken    token.Token
 
-	errors []string
+	// A token that was pushed back with its lexer errors, and is read
+	//  before the next token of the lexer
+	pushedBack       *token.Token
+	pushedBackErrors []diagnostic.Diagnostic
+
+	errors []diagnostic.Diagnostic
+
+	// Number of lexer errors already read, and the errors of the peek
+	//  token, which are added when it becomes the current token
+	lexerErrors int
+	peekErrors  []diagnostic.Diagnostic
+
+	// Number of errors the parser already recovered from
+	recovered int
+
+	// Position of the first token of the statement being parsed
+	statementPos token.Position
+
+	// Number of braces opened and not yet closed, up to the current
+	//  token
+	depth int
 
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns  map[token.TokenType]infixParseFn
@@ -54,16 +116,23 @@ type Parser struct {
 func New(l *lexer.Lexer) *Parser {
 	p := &Parser{
 		l:      l,
-		errors: []string{},
+		errors: []diagnostic.Diagnostic{},
 	}
 
 	p.prefixParseFns = make(map[token.TokenType]prefixParseFn)
 	p.registerPrefix(token.IDENT, p.parseIdentifier)
 	p.registerPrefix(token.INT, p.parseIntegerLiteral)
+	p.registerPrefix(token.FLOAT, p.parseFloatLiteral)
+	p.registerPrefix(token.STRING, p.parseStringLiteral)
 	p.registerPrefix(token.BANG, p.parsePrefixExpression)
 	p.registerPrefix(token.MINUS, p.parsePrefixExpression)
 	p.registerPrefix(token.TRUE, p.parseBoolean)
 	p.registerPrefix(token.FALSE, p.parseBoolean)
+	p.registerPrefix(token.LPAREN, p.parseGroupedExpression)
+	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
+	p.registerPrefix(token.LBRACE, p.parseHashLiteral)
+	p.registerPrefix(token.IF, p.parseIfExpression)
+	p.registerPrefix(token.FUNCTION, p.parseFunctionLiteral)
 
 	p.infixParseFns = make(map[token.TokenType]infixParseFn)
 	p.registerInfix(token.PLUS, p.parseInfixExpression)
@@ -74,6 +143,10 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(token.NOT_EQ, p.parseInfixExpression)
 	p.registerInfix(token.LT, p.parseInfixExpression)
 	p.registerInfix(token.GT, p.parseInfixExpression)
+	p.registerInfix(token.AND, p.parseLogicalExpression)
+	p.registerInfix(token.OR, p.parseLogicalExpression)
+	p.registerInfix(token.LPAREN, p.parseCallExpression)
+	p.registerInfix(token.LBRACKET, p.parseIndexExpression)
 
 	// Two tokens to set the current and peek tokens
 	p.nextToken()
@@ -82,22 +155,110 @@ func New(l *lexer.Lexer) *Parser {
 	return p
 }
 
+// Hints for common mistakes, passed by the parse function that expects
+//  the token
+const (
+	letNameHint   = "let statements bind a name, for example `let x = 5;`"
+	letAssignHint = "use `=` to bind a value to the name"
+	parameterHint = "function parameters are names, for example `fn(x, y) { x + y }`"
+	hashColonHint = "hash literals pair every key with a value, for example `{\"a\": 1}`"
+)
+
 // Errors returns the parser errors
-func (p *Parser) Errors() []string {
+func (p *Parser) Errors() []diagnostic.Diagnostic {
 	return p.errors
 }
 
+// addError adds an error diagnostic for a token
+func (p *Parser) addError(tkn token.Token, code diagnostic.Code, msg string) *diagnostic.Diagnostic {
+	p.errors = append(p.errors, diagnostic.Diagnostic{
+		Severity: diagnostic.Error,
+		Code:     code,
+		Message:  msg,
+		Start:    tkn.Pos,
+		End:      tkn.End(),
+		Found:    tkn.Type,
+	})
+
+	return &p.errors[len(p.errors)-1]
+}
+
 // peekError check for errors in the next token
-func (p *Parser) peekError(t token.TokenType) {
-	msg := fmt.Sprintf(`Found %s, whlie expecting the next token to be %s`, p.peekToken.Type, t)
-	p.errors = append(p.errors, msg)
+// The hint is added to the diagnostic when it is not empty
+func (p *Parser) peekError(t token.TokenType, hint string) {
+	// Illegal tokens are reported by the lexer, so its errors are added
+	//  now instead, and the statement is still recovered from
+	if p.peekTokenIs(token.ILLEGAL) {
+		p.errors = append(p.errors, p.peekErrors...)
+		p.peekErrors = nil
+		return
+	}
+
+	// The parser only reaches the end of the input for an expression,
+	//  and the missing expression was already reported
+	if p.currentTokenIs(token.EOF) {
+		return
+	}
+
+	msg := fmt.Sprintf(`Found %s, while expecting the next token to be %s`, p.peekToken.Type, t)
+	d := p.addError(p.peekToken, diagnostic.ErrUnexpectedToken, msg)
+	d.Expected = t
+	d.Hint = hint
 }
 
 // nextToken advance the parser to the next token
 func (p *Parser) nextToken() {
 	// Take the peek token from this parser
+	p.prevToken = p.currentToken
 	p.currentToken = p.peekToken
+	p.depth += braceDepth(p.currentToken.Type)
+
+	// The lexer errors of a token are added when it becomes the current
+	//  token, so they belong to the statement of the token
+	p.errors = append(p.errors, p.peekErrors...)
+	p.peekErrors = nil
+
+	if p.pushedBack != nil {
+		p.peekToken = *p.pushedBack
+		p.peekErrors = p.pushedBackErrors
+		p.pushedBack, p.pushedBackErrors = nil, nil
+		return
+	}
+
 	p.peekToken = p.l.NextToken()
+
+	// Comments are only kept for tools, when the lexer returns them
+	for p.peekToken.Type == token.COMMENT {
+		p.peekToken = p.l.NextToken()
+	}
+
+	if errs := p.l.Errors(); len(errs) > p.lexerErrors {
+		p.peekErrors = errs[p.lexerErrors:]
+		p.lexerErrors = len(errs)
+	}
+}
+
+// backup moves the parser back to the previous token
+// It can only go back one token
+func (p *Parser) backup() {
+	peek := p.peekToken
+	p.pushedBack, p.pushedBackErrors = &peek, p.peekErrors
+	p.peekErrors = nil
+	p.depth -= braceDepth(p.currentToken.Type)
+	p.peekToken = p.currentToken
+	p.currentToken = p.prevToken
+}
+
+// braceDepth returns how a token changes the depth of the braces
+func braceDepth(t token.TokenType) int {
+	switch t {
+	case token.LBRACE:
+		return 1
+	case token.RBRACE:
+		return -1
+	}
+
+	return 0
 }
 
 // ParseProgram creates a tree of statements from the lexer
@@ -107,26 +268,89 @@ func (p *Parser) ParseProgram() *ast.Program {
 
 	// Iterate through the tokens and create statements
 	for p.currentToken.Type != token.EOF {
-		stmt := p.parseStatement()
-		if stmt != nil {
-			program.Statements = append(program.Statements, stmt)
-		}
+		program.Statements = append(program.Statements, p.parseStatement())
 		p.nextToken()
+
+		if len(p.errors) >= MaxErrors {
+			p.tooManyErrors()
+			break
+		}
 	}
 
 	return program
 }
 
+// tooManyErrors stops reporting errors after MaxErrors
+func (p *Parser) tooManyErrors() {
+	p.errors = p.errors[:MaxErrors]
+
+	msg := fmt.Sprintf("Too many errors, stopped parsing after %d errors", MaxErrors)
+	d := p.addError(p.currentToken, diagnostic.ErrTooManyErrors, msg)
+	d.Severity = diagnostic.Note
+	d.Hint = "fix the first errors, since the others may be caused by them"
+}
+
 // parseStatement is a helper to parse a statement
 // It returns the Statement interface
+// After an error, the parser skips to the end of the statement, and
+//  statements that could not be parsed are replaced with a
+//  BadStatement
 func (p *Parser) parseStatement() ast.Statement {
+	start := p.currentToken
+	errors := len(p.errors)
+	depth := p.depth - braceDepth(start.Type)
+	p.statementPos = start.Pos
+
+	// Check for nil before returning, since a nil pointer inside the
+	//  interface would not be equal to nil
+	var stmt ast.Statement
+
 	switch p.currentToken.Type {
 	case token.LET:
-		return p.parseLetStatement()
+		if let := p.parseLetStatement(); let != nil {
+			stmt = let
+		}
 	case token.RETURN:
-		return p.parseReturnStatement()
+		stmt = p.parseReturnStatement()
 	default:
-		return p.parseExpressionStatement()
+		stmt = p.parseExpressionStatement()
+	}
+
+	// Errors in nested blocks were already recovered from
+	if len(p.errors) <= max(errors, p.recovered) {
+		return stmt
+	}
+
+	p.synchronize(depth)
+	p.recovered = len(p.errors)
+
+	if stmt == nil {
+		return &ast.BadStatement{Token: start, End: p.currentToken.End()}
+	}
+
+	return stmt
+}
+
+// synchronize skips the tokens of a statement with errors
+// It stops on the last token of the statement, that is either a
+//  semicolon, or the token before the next statement, the end of the
+//  block or the end of the input
+// The depth is the brace depth before the statement, so braces opened
+//  by the statement are skipped even when the error was inside them,
+//  and stray closing braces are skipped as well
+func (p *Parser) synchronize(depth int) {
+	for !p.currentTokenIs(token.EOF) {
+		closed := p.depth <= depth
+
+		if closed && p.currentTokenIs(token.SEMICOLON) {
+			return
+		}
+
+		if closed && (statementStart[p.peekToken.Type] || p.peekTokenIs(token.RBRACE) || p.peekTokenIs(token.EOF)) {
+			return
+		}
+
+		p.nextToken()
 	}
 }
 
@@ -136,7 +360,7 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 
 	// Check the peek only after the statement was created
 	//  since this function will change the parser state
-	if !p.expectPeek(token.IDENT) {
+	if !p.expectPeekHint(token.IDENT, letNameHint) {
 		return nil
 	}
 	stmt.Name = &ast.Identifier{
@@ -144,13 +368,16 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 		Value: p.currentToken.Literal,
 	}
 
-	if !p.expectPeek(token.ASSIGN) {
+	if !p.expectPeekHint(token.ASSIGN, letAssignHint) {
 		return nil
 	}
 
-	// Skip the semicolon
-	// This will be replaced later, once the
-	for !p.currentTokenIs(token.SEMICOLON) {
+	// Move to the first token of the value
+	p.nextToken()
+	stmt.Value = p.parseExpression(LOWEST)
+
+	// The semicolons are optional, like in expression statements
+	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
 
@@ -161,11 +388,21 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	stmt := &ast.ReturnStatement{Token: p.currentToken}
 
+	// Return without a value, at the end of a statement or a block
+	if p.peekTokenIs(token.RBRACE) || p.peekTokenIs(token.EOF) {
+		return stmt
+	}
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+		return stmt
+	}
+
 	// Go to the next token after the return statement
 	p.nextToken()
 
-	// Parse until the semicolon
-	for !p.currentTokenIs(token.SEMICOLON) {
+	stmt.ReturnValue = p.parseExpression(LOWEST)
+
+	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
 
@@ -191,14 +428,25 @@ func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 // parseExpression parse individual expression from a statement
 // it checks if there is a parsing function for the current token
 func (p *Parser) parseExpression(precedence int) ast.Expression {
+	start := p.currentToken
 	prefix := p.prefixParseFns[p.currentToken.Type]
 
 	if prefix == nil {
 		p.noPrefixParseFnError(p.currentToken.Type)
-		return nil
+
+		// Leave closing brackets and separators for the expression or
+		//  the block they belong to, unless they start the statement
+		if closingTokens[start.Type] && start.Pos != p.statementPos {
+			p.backup()
+		}
+		return &ast.BadExpression{Token: start}
 	}
 
+	// The parse functions return nil after an error
 	leftExp := prefix()
+	if leftExp == nil {
+		return &ast.BadExpression{Token: start}
+	}
 
 	for !p.peekTokenIs(token.SEMICOLON) && precedence < p.peekPrecedence() {
 		infix := p.infixParseFns[p.peekToken.Type]
@@ -209,6 +457,9 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 		p.nextToken()
 
 		leftExp = infix(leftExp)
+		if leftExp == nil {
+			return &ast.BadExpression{Token: start}
+		}
 	}
 
 	return leftExp
@@ -216,8 +467,22 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 
 // noPrefixParseFnError() adds a prefix prefix parse error
 func (p *Parser) noPrefixParseFnError(t token.TokenType) {
+	// Illegal tokens were already reported by the lexer
+	if t == token.ILLEGAL {
+		return
+	}
+
+	// Unterminated statements, for example `let x =` at the end of
+	//  the input
+	if t == token.EOF {
+		d := p.addError(p.currentToken, diagnostic.ErrUnexpectedEOF, "Unexpected end of input, while expecting an expression")
+		d.Hint = "the statement is incomplete"
+		return
+	}
+
 	msg := fmt.Sprintf("No prefix parse function found for type %s", t)
-	p.errors = append(p.errors, msg)
+	d := p.addError(p.currentToken, diagnostic.ErrNoPrefixParseFn, msg)
+	d.Hint = fmt.Sprintf("an expression cannot start with %q", p.currentToken.Literal)
 }
 
 // currentTokenIs check the current token against a type
@@ -232,11 +497,16 @@ func (p *Parser) peekTokenIs(t token.TokenType) bool {
 
 // expectPeek advance to the next token if the peek match a type
 func (p *Parser) expectPeek(t token.TokenType) bool {
+	return p.expectPeekHint(t, "")
+}
+
+// expectPeekHint is expectPeek with a hint for the error
+func (p *Parser) expectPeekHint(t token.TokenType, hint string) bool {
 	if p.peekTokenIs(t) {
 		p.nextToken()
 		return true
 	} else {
-		p.peekError(t)
+		p.peekError(t, hint)
 		return false
 	}
 }
@@ -256,19 +526,11 @@ func (p *Parser) registerInfix(tokenType token.TokenType, fn infixParseFn) {
 }
 
 func (p *Parser) peekPrecedence() int {
-	if p, ok := precedences[p.peekToken.Type]; ok {
-		return p
-	}
-
-	return LOWEST
+	return Precedence(p.peekToken.Type)
 }
 
 func (p *Parser) currentPrecedence() int {
-	if p, ok := precedences[p.currentToken.Type]; ok {
-		return p
-	}
-
-	return LOWEST
+	return Precedence(p.currentToken.Type)
 }
 
 // parseIdentifier returns an identifier with the current token, and
@@ -281,7 +543,7 @@ func (p *Parser) parseIntegerLiteral() (exp ast.Expression) {
 	value, err := strconv.ParseInt(p.currentToken.Literal, 0, 64)
 	if err != nil {
 		msg := fmt.Sprintf("Could not parse %q as integer", p.currentToken.Literal)
-		p.errors = append(p.errors, msg)
+		p.addError(p.currentToken, diagnostic.ErrInvalidInteger, msg)
 		return
 	}
 
@@ -293,6 +555,30 @@ func (p *Parser) parseIntegerLiteral() (exp ast.Expression) {
 	return exp
 }
 
+// parseFloatLiteral parses a float, that is out of range when it is too
+//  large for a float64
+func (p *Parser) parseFloatLiteral() ast.Expression {
+	value, err := strconv.ParseFloat(p.currentToken.Literal, 64)
+	if err != nil {
+		msg := fmt.Sprintf("Could not parse %q as float", p.currentToken.Literal)
+		p.addError(p.currentToken, diagnostic.ErrInvalidFloat, msg)
+		return nil
+	}
+
+	return &ast.FloatLiteral{Token: p.currentToken, Value: value}
+}
+
+// parseStringLiteral decodes the escape sequences of a string
+func (p *Parser) parseStringLiteral() ast.Expression {
+	value, err := lexer.Unquote(p.currentToken.Literal)
+	if err != nil {
+		p.addError(p.currentToken, diagnostic.ErrInvalidEscape, err.Error())
+		return nil
+	}
+
+	return &ast.StringLiteral{Token: p.currentToken, Value: value}
+}
+
 func (p *Parser) parsePrefixExpression() ast.Expression {
 	exp := &ast.PrefixExpression{
 		Token:    p.currentToken,
@@ -320,9 +606,267 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	return exp
 }
 
+// parseLogicalExpression parses && and || like left associative infix
+//  operators
+func (p *Parser) parseLogicalExpression(left ast.Expression) ast.Expression {
+	exp := &ast.LogicalExpression{
+		Token:    p.currentToken,
+		Left:     left,
+		Operator: p.currentToken.Literal,
+	}
+
+	precedence := p.currentPrecedence()
+	p.nextToken()
+	exp.Right = p.parseExpression(precedence)
+
+	return exp
+}
+
 func (p *Parser) parseBoolean() ast.Expression {
 	return &ast.BooleanLiteral{
 		Token: p.currentToken,
 		Value: p.currentTokenIs(token.TRUE),
 	}
 }
+
+// parseGroupedExpression parses an expression between parentheses
+// The parentheses only change the precedence, so there is no node for
+//  them in the tree
+func (p *Parser) parseGroupedExpression() ast.Expression {
+	p.nextToken()
+
+	errors := len(p.errors)
+	exp := p.parseExpression(LOWEST)
+
+	if !p.expectClosing(token.RPAREN, errors) {
+		return nil
+	}
+
+	return exp
+}
+
+// parseIfExpression parses a condition followed by a block, and an
+//  optional else block
+func (p *Parser) parseIfExpression() ast.Expression {
+	exp := &ast.IfExpression{Token: p.currentToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	p.nextToken()
+	errors := len(p.errors)
+	exp.Condition = p.parseExpression(LOWEST)
+
+	if !p.expectClosing(token.RPAREN, errors) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	exp.Consequence = p.parseBlockStatement()
+
+	if p.peekTokenIs(token.ELSE) {
+		p.nextToken()
+
+		if !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+
+		exp.Alternative = p.parseBlockStatement()
+	}
+
+	return exp
+}
+
+// parseBlockStatement parses statements until the closing brace
+// It starts on the opening brace, and stops on the closing brace
+func (p *Parser) parseBlockStatement() *ast.BlockStatement {
+	block := &ast.BlockStatement{
+		Token:      p.currentToken,
+		Statements: []ast.Statement{},
+	}
+
+	p.nextToken()
+
+	for !p.currentTokenIs(token.RBRACE) {
+		// Unterminated block at the end of the input
+		if p.currentTokenIs(token.EOF) {
+			d := p.addError(p.currentToken, diagnostic.ErrUnexpectedEOF, "Unexpected end of input, while expecting }")
+			d.Expected = token.RBRACE
+			d.Hint = fmt.Sprintf("the block opened at %s is not closed", block.Token.Pos)
+			break
+		}
+
+		block.Statements = append(block.Statements, p.parseStatement())
+		p.nextToken()
+	}
+
+	return block
+}
+
+// parseFunctionLiteral parses the parameters and the body of a function
+func (p *Parser) parseFunctionLiteral() ast.Expression {
+	fn := &ast.FunctionLiteral{Token: p.currentToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	fn.Parameters = p.parseFunctionParameters()
+	if fn.Parameters == nil {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	fn.Body = p.parseBlockStatement()
+
+	return fn
+}
+
+// parseFunctionParameters parses a comma separated list of identifiers
+// It starts on the opening parenthesis, and returns nil on errors
+func (p *Parser) parseFunctionParameters() []*ast.Identifier {
+	identifiers := []*ast.Identifier{}
+
+	if p.peekTokenIs(token.RPAREN) {
+		p.nextToken()
+		return identifiers
+	}
+
+	if !p.expectPeekHint(token.IDENT, parameterHint) {
+		return nil
+	}
+	identifiers = append(identifiers, &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal})
+
+	for p.peekTokenIs(token.COMMA) {
+		p.nextToken()
+		if !p.expectPeekHint(token.IDENT, parameterHint) {
+			return nil
+		}
+		identifiers = append(identifiers, &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal})
+	}
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	return identifiers
+}
+
+// parseCallExpression parses the arguments of a call
+// The function was already parsed as the left expression
+func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
+	exp := &ast.CallExpression{Token: p.currentToken, Function: function}
+
+	exp.Arguments = p.parseExpressionList(token.RPAREN)
+	if exp.Arguments == nil {
+		return nil
+	}
+
+	return exp
+}
+
+// parseArrayLiteral parses the elements of an array
+func (p *Parser) parseArrayLiteral() ast.Expression {
+	array := &ast.ArrayLiteral{Token: p.currentToken}
+
+	array.Elements = p.parseExpressionList(token.RBRACKET)
+	if array.Elements == nil {
+		return nil
+	}
+
+	return array
+}
+
+// parseHashLiteral parses the key and value pairs between braces
+// Blocks are parsed by the statements that have them, so a brace in
+//  the position of an expression is always a hash literal
+func (p *Parser) parseHashLiteral() ast.Expression {
+	hash := &ast.HashLiteral{Token: p.currentToken, Pairs: []ast.HashPair{}}
+
+	for !p.peekTokenIs(token.RBRACE) {
+		p.nextToken()
+		key := p.parseExpression(LOWEST)
+
+		if !p.expectPeekHint(token.COLON, hashColonHint) {
+			return nil
+		}
+
+		p.nextToken()
+		value := p.parseExpression(LOWEST)
+
+		hash.Pairs = append(hash.Pairs, ast.HashPair{Key: key, Value: value})
+
+		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+
+	return hash
+}
+
+// parseIndexExpression parses the index between brackets
+// The array was already parsed as the left expression
+func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
+	exp := &ast.IndexExpression{Token: p.currentToken, Left: left}
+
+	p.nextToken()
+	errors := len(p.errors)
+	exp.Index = p.parseExpression(LOWEST)
+
+	if !p.expectClosing(token.RBRACKET, errors) {
+		return nil
+	}
+
+	return exp
+}
+
+// parseExpressionList parses a comma separated list of expressions,
+//  until the end token
+// It starts on the opening token, and returns nil on errors
+func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
+	list := []ast.Expression{}
+
+	if p.peekTokenIs(end) {
+		p.nextToken()
+		return list
+	}
+
+	p.nextToken()
+	errors := len(p.errors)
+	list = append(list, p.parseExpression(LOWEST))
+
+	for p.peekTokenIs(token.COMMA) {
+		p.nextToken()
+		p.nextToken()
+		list = append(list, p.parseExpression(LOWEST))
+	}
+
+	if !p.expectClosing(end, errors) {
+		return nil
+	}
+
+	return list
+}
+
+// expectClosing is expectPeek for the token that closes an expression
+// The errors are the number of errors before the expression inside
+// After an error inside, the closing token is often missing because of
+//  the same mistake, so its error is left out
+func (p *Parser) expectClosing(t token.TokenType, errors int) bool {
+	if len(p.errors) > errors && !p.peekTokenIs(t) {
+		return false
+	}
+
+	return p.expectPeek(t)
+}
@@ -2,10 +2,14 @@ package parser
 
 import (
 	"fmt"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/shavit/go-interpreter/ast"
+	"github.com/shavit/go-interpreter/diagnostic"
 	"github.com/shavit/go-interpreter/lexer"
+	"github.com/shavit/go-interpreter/token"
 )
 
 func TestLetStatements(t *testing.T) {
@@ -172,6 +176,40 @@ func TestIntegerLiteralExpression(t *testing.T) {
 	}
 }
 
+func TestFloatLiteralExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"3.14", 3.14},
+		{".5", 0.5},
+		{"1e-9", 1e-9},
+		{"2E3", 2000},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		literal, ok := stmt.Expression.(*ast.FloatLiteral)
+		if !ok {
+			t.Fatalf("Got %T, while expecting stmt.Expression to be *ast.FloatLiteral", stmt.Expression)
+		}
+		if literal.Value != tt.expected || literal.String() != tt.input {
+			t.Errorf("Found %s (%g), while expecting %s (%g)", literal, literal.Value, tt.input, tt.expected)
+		}
+	}
+
+	p := New(lexer.New("1e400"))
+	p.ParseProgram()
+	if errors := p.Errors(); len(errors) != 1 || errors[0].Code != diagnostic.ErrInvalidFloat {
+		t.Errorf("Found %v, while expecting an invalid float", errors)
+	}
+}
+
 func TestParsePrefixExpressions(t *testing.T) {
 	prefixTests := []struct {
 		input        string
@@ -298,6 +336,25 @@ func TestOPeratorPrecendenceParsing(t *testing.T) {
 		{"5 > 4 == 3 < 4", "((5 > 4) == (3 < 4))"},
 		{"5 < 4 != 3 > 4", "((5 < 4) != (3 > 4))"},
 		{"3 + 4 * 5 == 3 * 1 + 4 * 5", "((3 + (4 * 5)) == ((3 * 1) + (4 * 5)))"},
+		{"1 + (2 + 3) + 4", "((1 + (2 + 3)) + 4)"},
+		{"(5 + 5) * 2", "((5 + 5) * 2)"},
+		{"2 / (5 + 5)", "(2 / (5 + 5))"},
+		{"-(5 + 5)", "(-(5 + 5))"},
+		{"!(true == true)", "(!(true == true))"},
+		{"a + add(b * c) + d", "((a + add((b * c))) + d)"},
+		{"add(a, b, 1, 2 * 3, 4 + 5, add(6, 7 * 8))", "add(a, b, 1, (2 * 3), (4 + 5), add(6, (7 * 8)))"},
+		{"add(a + b + c * d / f + g)", "add((((a + b) + ((c * d) / f)) + g))"},
+		{"let add = fn(x, y) { x + y }; add(1, 2 * 3)", "let add = fn(x, y) { (x + y) };add(1, (2 * 3))"},
+		{"a * [1, 2, 3, 4][b * c] * d", "((a * ([1, 2, 3, 4][(b * c)])) * d)"},
+		{"add(a * b[2], b[1], 2 * [1, 2][1])", "add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))"},
+		{"-a[0]; f(x)[1]; a[0][1]", "(-(a[0]))(f(x)[1])((a[0])[1])"},
+		{"a || b && c", "(a || (b && c))"},
+		{"a && b || c && d", "((a && b) || (c && d))"},
+		{"a || b || c", "((a || b) || c)"},
+		{"a == b && c < d + 1", "((a == b) && (c < (d + 1)))"},
+		{"!a && -b", "((!a) && (-b))"},
+		{"x != 0 && 10 / x > 1", "((x != 0) && ((10 / x) > 1))"},
+		{"(a || b) && c", "((a || b) && c)"},
 	}
 
 	for _, tt := range tests {
@@ -390,3 +447,634 @@ func testInfixExpression(t *testing.T, exp ast.Expression, left interface{}, ope
 
 	return true
 }
+
+func TestParserDiagnostics(t *testing.T) {
+	l := lexer.NewFile("main.mk", "let 5 = 4;")
+	p := New(l)
+	p.ParseProgram()
+
+	errors := p.Errors()
+	if len(errors) == 0 {
+		t.Fatalf("Found no errors, while expecting a diagnostic")
+	}
+
+	d := errors[0]
+	if d.Code != diagnostic.ErrUnexpectedToken {
+		t.Errorf("Found %s, while expecting d.Code to be %s", d.Code, diagnostic.ErrUnexpectedToken)
+	}
+	if d.Expected != token.IDENT || d.Found != token.INT {
+		t.Errorf("Found expected %s and found %s, while expecting IDENT and INT", d.Expected, d.Found)
+	}
+	if d.Start.String() != "main.mk:1:5" || d.End.Column != 6 {
+		t.Errorf("Found span %s-%d, while expecting main.mk:1:5-6", d.Start, d.End.Column)
+	}
+}
+
+func TestLetAndReturnValues(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x = 5;", "let x = 5;"},
+		{"let y = a + b * c;", "let y = (a + (b * c));"},
+		{"let z = -1", "let z = (-1);"},
+		{"return 7;", "return 7;"},
+		{"return x == y", "return (x == y);"},
+		{"return;", "return ;"},
+		{"let a = 1 let b = 2", "let a = 1;let b = 2;"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		actual := program.String()
+		if actual != tt.expected {
+			t.Errorf("Found %q, while expecting %q", actual, tt.expected)
+		}
+	}
+}
+
+func TestUnterminatedStatements(t *testing.T) {
+	tests := []string{
+		"let x =",
+		"let x = 5 +",
+		"return -",
+		"f(1,",
+		"x[",
+		"[1, 2,",
+	}
+
+	for _, input := range tests {
+		l := lexer.New(input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != 1 {
+			t.Fatalf("Found %d errors, while expecting 1 for %q", len(errors), input)
+		}
+		if errors[0].Code != diagnostic.ErrUnexpectedEOF {
+			t.Errorf("Found %s, while expecting %s for %q", errors[0].Code, diagnostic.ErrUnexpectedEOF, input)
+		}
+	}
+}
+
+func TestIfExpression(t *testing.T) {
+	input := `if (x < y) { x }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("Found %d, while expecting 1 statement", len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("Found %T, while expecting program.Statements[0] to be ast.ExpressionStatement", program.Statements[0])
+	}
+
+	exp, ok := stmt.Expression.(*ast.IfExpression)
+	if !ok {
+		t.Fatalf("Found %T, while expecting stmt.Expression to be ast.IfExpression", stmt.Expression)
+	}
+
+	if !testInfixExpression(t, exp.Condition, "x", "<", "y") {
+		return
+	}
+
+	if len(exp.Consequence.Statements) != 1 {
+		t.Fatalf("Found %d, while expecting 1 consequence statement", len(exp.Consequence.Statements))
+	}
+
+	consequence, ok := exp.Consequence.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("Found %T, while expecting ast.ExpressionStatement", exp.Consequence.Statements[0])
+	}
+
+	if !testIdentifier(t, consequence.Expression, "x") {
+		return
+	}
+
+	if exp.Alternative != nil {
+		t.Errorf("Found %+v, while expecting exp.Alternative to be nil", exp.Alternative)
+	}
+}
+
+func TestIfElseExpression(t *testing.T) {
+	input := `if (x < y) { x } else { return y; }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	exp, ok := stmt.Expression.(*ast.IfExpression)
+	if !ok {
+		t.Fatalf("Found %T, while expecting stmt.Expression to be ast.IfExpression", stmt.Expression)
+	}
+
+	if exp.Alternative == nil || len(exp.Alternative.Statements) != 1 {
+		t.Fatalf("Found %+v, while expecting 1 alternative statement", exp.Alternative)
+	}
+
+	if _, ok := exp.Alternative.Statements[0].(*ast.ReturnStatement); !ok {
+		t.Fatalf("Found %T, while expecting ast.ReturnStatement", exp.Alternative.Statements[0])
+	}
+
+	if program.String() != "if(x < y) { x } else { return y; }" {
+		t.Errorf("Found %q, while expecting the string representation of the if expression", program.String())
+	}
+}
+
+func TestUnterminatedBlock(t *testing.T) {
+	l := lexer.New("if (x) { x")
+	p := New(l)
+	p.ParseProgram()
+
+	errors := p.Errors()
+	if len(errors) != 1 {
+		t.Fatalf("Found %d errors, while expecting 1", len(errors))
+	}
+	if errors[0].Code != diagnostic.ErrUnexpectedEOF || errors[0].Expected != token.RBRACE {
+		t.Errorf("Found %q, while expecting an unexpected end of input", errors[0])
+	}
+}
+
+func TestErrorRecovery(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		lines    []int
+	}{
+		{"let = 1; let x = 2;", "<bad statement>let x = 2;", []int{1}},
+		{"let x = 5 +;\nlet y = 2;", "let x = (5 + <bad expression>);let y = 2;", []int{1}},
+		{"let a = ;\nlet b = ;\nreturn a", "let a = <bad expression>;let b = <bad expression>;return a;", []int{1, 2}},
+		{"let f = fn(x) { let = 1; x + };\nlet z = 3;", "let f = fn(x) { <bad statement>(x + <bad expression>) };let z = 3;", []int{1, 1}},
+		{"if (x +) { y }; z", "if(x + <bad expression>) { y }z", []int{1}},
+		{"let x 5; let y = 2", "<bad statement>let y = 2;", []int{1}},
+		{"{1: 2, 3 4, 5: 6}\nlet y = 2;", "<bad expression>let y = 2;", []int{1}},
+		{"let h = {1: 2, 3 4};\nlet y = 2;", "let h = <bad expression>;let y = 2;", []int{1}},
+		{"1 }\nlet y = 2;", "1<bad expression>let y = 2;", []int{1}},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+
+		actual := program.String()
+		if actual != tt.expected {
+			t.Errorf("Found %q, while expecting %q", actual, tt.expected)
+		}
+
+		errors := p.Errors()
+		lines := []int{}
+		for _, e := range errors {
+			lines = append(lines, e.Start.Line)
+		}
+		if !reflect.DeepEqual(lines, tt.lines) {
+			t.Errorf("Found errors %v, while expecting errors on the lines %v for %q", errors, tt.lines, tt.input)
+		}
+	}
+}
+
+// A mistake inside brackets does not add an error for the closing
+//  bracket
+func TestErrorInsideBrackets(t *testing.T) {
+	tests := []string{
+		"let a = (1 + ;\nlet b = 2;",
+		"f(1 +, 2); let b = 1;",
+		"[1 +, 2]; let b = 1;",
+		"x[1 + ; let b = 1;",
+		"if (1 + ; let b = 1;",
+		"if (1 + ) { 2 }; let b = 1;",
+		"{1 +: 2}; let b = 1;",
+		"{1: 2 +, 3: 4}; let b = 1;",
+	}
+
+	for _, input := range tests {
+		p := New(lexer.New(input))
+		program := p.ParseProgram()
+
+		if errors := p.Errors(); len(errors) != 1 {
+			t.Errorf("Found errors %v, while expecting one error for %q", errors, input)
+		}
+
+		last := program.Statements[len(program.Statements)-1]
+		if !strings.HasPrefix(last.String(), "let b") {
+			t.Errorf("Found %q, while expecting the let statement after the error for %q", last.String(), input)
+		}
+	}
+}
+
+// Illegal tokens are only reported by the lexer
+func TestIllegalTokenErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected diagnostic.Code
+	}{
+		{"f(1 @ 2)", diagnostic.ErrIllegalCharacter},
+		{"let \xff = 1", diagnostic.ErrInvalidUTF8},
+		{"let x @ 1; let y = 2", diagnostic.ErrIllegalCharacter},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != 1 || errors[0].Code != tt.expected {
+			t.Errorf("Found errors %v, while expecting only %s for %q", errors, tt.expected, tt.input)
+		}
+	}
+}
+
+func TestTooManyErrors(t *testing.T) {
+	input := strings.Repeat("let = 1;\n", MaxErrors+5)
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+
+	errors := p.Errors()
+	if len(errors) != MaxErrors+1 {
+		t.Fatalf("Found %d errors, while expecting %d", len(errors), MaxErrors+1)
+	}
+
+	last := errors[MaxErrors]
+	if last.Code != diagnostic.ErrTooManyErrors || last.Severity != diagnostic.Note {
+		t.Errorf("Found %q, while expecting a note about too many errors", last)
+	}
+
+	if len(program.Statements) != MaxErrors {
+		t.Errorf("Found %d statements, while expecting %d", len(program.Statements), MaxErrors)
+	}
+}
+
+func TestFunctionLiteralParsing(t *testing.T) {
+	input := `fn(x, y) { x + y; }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("Found %d, while expecting 1 statement", len(program.Statements))
+	}
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	function, ok := stmt.Expression.(*ast.FunctionLiteral)
+	if !ok {
+		t.Fatalf("Found %T, while expecting stmt.Expression to be ast.FunctionLiteral", stmt.Expression)
+	}
+
+	if len(function.Parameters) != 2 {
+		t.Fatalf("Found %d, while expecting 2 parameters", len(function.Parameters))
+	}
+
+	testLiteralExpression(t, function.Parameters[0], "x")
+	testLiteralExpression(t, function.Parameters[1], "y")
+
+	if len(function.Body.Statements) != 1 {
+		t.Fatalf("Found %d, while expecting 1 body statement", len(function.Body.Statements))
+	}
+
+	bodyStmt, ok := function.Body.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("Found %T, while expecting ast.ExpressionStatement", function.Body.Statements[0])
+	}
+
+	testInfixExpression(t, bodyStmt.Expression, "x", "+", "y")
+}
+
+func TestFunctionParameterParsing(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedParams []string
+	}{
+		{"fn() {};", []string{}},
+		{"fn(x) {};", []string{"x"}},
+		{"fn(x, y, z) {};", []string{"x", "y", "z"}},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		function := stmt.Expression.(*ast.FunctionLiteral)
+
+		if len(function.Parameters) != len(tt.expectedParams) {
+			t.Errorf("Found %d, while expecting %d parameters", len(function.Parameters), len(tt.expectedParams))
+		}
+
+		for i, ident := range tt.expectedParams {
+			testLiteralExpression(t, function.Parameters[i], ident)
+		}
+	}
+}
+
+// The hint belongs to the parameters, not to the let statements
+func TestFunctionParameterErrors(t *testing.T) {
+	tests := []string{"fn(x, ) {}", "fn(1) {}"}
+
+	for _, input := range tests {
+		p := New(lexer.New(input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Fatalf("Found no errors, while expecting a diagnostic for %q", input)
+		}
+
+		d := errors[0]
+		if d.Expected != token.IDENT || !strings.Contains(d.Hint, "function parameters") {
+			t.Errorf("Found %+v, while expecting a parameter hint for %q", d, input)
+		}
+	}
+}
+
+func TestCallExpressionParsing(t *testing.T) {
+	input := "add(1, 2 * 3, 4 + 5);"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("Found %d, while expecting 1 statement", len(program.Statements))
+	}
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	exp, ok := stmt.Expression.(*ast.CallExpression)
+	if !ok {
+		t.Fatalf("Found %T, while expecting stmt.Expression to be ast.CallExpression", stmt.Expression)
+	}
+
+	if !testIdentifier(t, exp.Function, "add") {
+		return
+	}
+
+	if len(exp.Arguments) != 3 {
+		t.Fatalf("Found %d, while expecting 3 arguments", len(exp.Arguments))
+	}
+
+	testLiteralExpression(t, exp.Arguments[0], 1)
+	testInfixExpression(t, exp.Arguments[1], 2, "*", 3)
+	testInfixExpression(t, exp.Arguments[2], 4, "+", 5)
+}
+
+func TestArrayLiteralParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		elements int
+	}{
+		{"[1, 2 * 2, 3 + 3]", 3},
+		{"[]", 0},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		array, ok := stmt.Expression.(*ast.ArrayLiteral)
+		if !ok {
+			t.Fatalf("Found %T, while expecting stmt.Expression to be ast.ArrayLiteral", stmt.Expression)
+		}
+
+		if len(array.Elements) != tt.elements {
+			t.Fatalf("Found %d, while expecting %d elements", len(array.Elements), tt.elements)
+		}
+	}
+
+	program := New(lexer.New("[1, 2 * 2, 3 + 3]")).ParseProgram()
+	array := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.ArrayLiteral)
+	testIntegerLiteral(t, array.Elements[0], 1)
+	testInfixExpression(t, array.Elements[1], 2, "*", 2)
+	testInfixExpression(t, array.Elements[2], 3, "+", 3)
+}
+
+func TestHashLiteralParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"one": 1, "two": 2, "three": 3}`, `{"one": 1, "two": 2, "three": 3}`},
+		{"{}", "{}"},
+		{`{"one": 0 + 1, two: 10 - 8, 3: 15 / 5, true: [1]}`, `{"one": (0 + 1), two: (10 - 8), 3: (15 / 5), true: [1]}`},
+		{`let m = {"a": {"b": 1}}; m["a"]["b"]`, `let m = {"a": {"b": 1}};((m["a"])["b"])`},
+		{`fn() { {"a": 1} }`, `fn() { {"a": 1} }`},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if actual := program.String(); actual != tt.expected {
+			t.Errorf("Found %q, while expecting %q", actual, tt.expected)
+		}
+	}
+
+	program := New(lexer.New(`{"one": 1, "two": 2}`)).ParseProgram()
+	hash, ok := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.HashLiteral)
+	if !ok {
+		t.Fatalf("Found %T, while expecting ast.HashLiteral", program.Statements[0].(*ast.ExpressionStatement).Expression)
+	}
+
+	expected := []struct {
+		key   string
+		value int64
+	}{{"one", 1}, {"two", 2}}
+
+	if len(hash.Pairs) != len(expected) {
+		t.Fatalf("Found %d, while expecting %d pairs", len(hash.Pairs), len(expected))
+	}
+	for i, pair := range hash.Pairs {
+		if key, ok := pair.Key.(*ast.StringLiteral); !ok || key.Value != expected[i].key {
+			t.Errorf("Found key %s, while expecting %q", pair.Key, expected[i].key)
+		}
+		testIntegerLiteral(t, pair.Value, expected[i].value)
+	}
+}
+
+func TestHashLiteralErrors(t *testing.T) {
+	p := New(lexer.New(`{"a" 1}`))
+	p.ParseProgram()
+
+	errors := p.Errors()
+	if len(errors) == 0 {
+		t.Fatalf("Found no errors, while expecting a diagnostic")
+	}
+
+	d := errors[0]
+	if d.Code != diagnostic.ErrUnexpectedToken || d.Expected != token.COLON || d.Hint == "" {
+		t.Errorf("Found %+v, while expecting a missing colon with a hint", d)
+	}
+}
+
+func TestLogicalExpressionParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		left     interface{}
+		operator string
+		right    interface{}
+	}{
+		{"a && b", "a", "&&", "b"},
+		{"1 || 2", 1, "||", 2},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		exp, ok := stmt.Expression.(*ast.LogicalExpression)
+		if !ok {
+			t.Fatalf("Found %T, while expecting stmt.Expression to be ast.LogicalExpression", stmt.Expression)
+		}
+
+		testLiteralExpression(t, exp.Left, tt.left)
+		if exp.Operator != tt.operator {
+			t.Errorf("Found %q, while expecting %q", exp.Operator, tt.operator)
+		}
+		testLiteralExpression(t, exp.Right, tt.right)
+	}
+}
+
+func TestIndexExpressionParsing(t *testing.T) {
+	input := "myArray[1 + 1]"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	exp, ok := stmt.Expression.(*ast.IndexExpression)
+	if !ok {
+		t.Fatalf("Found %T, while expecting stmt.Expression to be ast.IndexExpression", stmt.Expression)
+	}
+
+	if !testIdentifier(t, exp.Left, "myArray") {
+		return
+	}
+
+	testInfixExpression(t, exp.Index, 1, "+", 1)
+}
+
+func TestStringLiteralExpression(t *testing.T) {
+	input := `"hello\tworld";`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	literal, ok := stmt.Expression.(*ast.StringLiteral)
+	if !ok {
+		t.Fatalf("Found %T, while expecting stmt.Expression to be *ast.StringLiteral", stmt.Expression)
+	}
+
+	if literal.Value != "hello\tworld" {
+		t.Errorf("Found %q, while expecting %q", literal.Value, "hello\tworld")
+	}
+
+	if literal.String() != `"hello\tworld"` {
+		t.Errorf("Found %q, while expecting %q", literal.String(), `"hello\tworld"`)
+	}
+}
+
+func TestUnterminatedStringLiteral(t *testing.T) {
+	l := lexer.New(`let s = "abc;`)
+	p := New(l)
+	p.ParseProgram()
+
+	errors := p.Errors()
+	if len(errors) != 1 {
+		t.Fatalf("Found %d errors, while expecting 1: %v", len(errors), errors)
+	}
+
+	if errors[0].Code != diagnostic.ErrUnterminatedString {
+		t.Errorf("Found %s, while expecting %s", errors[0].Code, diagnostic.ErrUnterminatedString)
+	}
+
+	if errors[0].Start.Column != 9 {
+		t.Errorf("Found column %d, while expecting 9", errors[0].Start.Column)
+	}
+}
+
+func TestParseWithComments(t *testing.T) {
+	input := `// add two numbers
+let add = fn(x, y) { /* sum */ x + y }; // done`
+
+	for _, mode := range []lexer.Mode{lexer.SkipComments, lexer.ScanComments, lexer.AttachComments} {
+		l := lexer.New(input)
+		l.SetMode(mode)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != "let add = fn(x, y) { (x + y) };" {
+			t.Errorf("Found %q in mode %d, while expecting the comments to be ignored", program.String(), mode)
+		}
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	tests := []string{
+		`let x = 5; return x;`,
+		`let add = fn(x, y) { x + y }; add(1, 2 * 3);`,
+		`if (x < y) { x } else { return; }`,
+		`!true == false; -a * "b\n"; fn() {}()`,
+		`let price = 1.5e3 * .25;`,
+		`let a = [1, "two", [], fn(x) { x }]; a[-1](a[0]);`,
+		`let m = {"a": 1, true: {}, 2: [3]}; m["a"];`,
+		`a && !b || c == d;`,
+		`// leading comment
+let s = "héllo";`,
+	}
+
+	for _, input := range tests {
+		l := lexer.NewFile("test.mk", input)
+		l.SetMode(lexer.AttachComments)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		data, err := ast.MarshalJSON(program)
+		if err != nil {
+			t.Fatalf("Found error %v for %q", err, input)
+		}
+
+		node, err := ast.UnmarshalJSON(data)
+		if err != nil {
+			t.Fatalf("Found error %v for %q", err, input)
+		}
+
+		if node.String() != program.String() {
+			t.Errorf("Found %q, while expecting %q", node.String(), program.String())
+		}
+
+		if !reflect.DeepEqual(node, program) {
+			t.Errorf("Found a different tree after decoding %q", input)
+		}
+	}
+}
@@ -4,31 +4,305 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"os"
+	"strings"
 
+	"github.com/shavit/go-interpreter/diagnostic"
+	"github.com/shavit/go-interpreter/evaluator"
 	"github.com/shavit/go-interpreter/lexer"
+	"github.com/shavit/go-interpreter/object"
+	"github.com/shavit/go-interpreter/parser"
 	"github.com/shavit/go-interpreter/token"
 )
 
 const PROMPT = ">> "
 
-// Start starts teh repl
-// It starts to scan the input line by line to
-//   create tokens, then print it out
+// CONTINUATION_PROMPT is printed while the input is incomplete
+const CONTINUATION_PROMPT = ".. "
+
+// Mode selects what the repl prints for every input
+type Mode int
+
+const (
+	// EvalMode evaluates the input and prints the result
+	EvalMode Mode = iota
+
+	// ASTMode prints the parsed program
+	ASTMode
+
+	// TokensMode prints the tokens of the input
+	TokensMode
+)
+
+// Commands that switch the mode
+var modes = map[string]Mode{
+	":eval":   EvalMode,
+	":ast":    ASTMode,
+	":tokens": TokensMode,
+}
+
+// session holds the state of the repl between inputs
+// The environment keeps the bindings of every evaluated input, and the
+//  transcript keeps the inputs so they can be saved and replayed
+type session struct {
+	out  io.Writer
+	mode Mode
+
+	env        *object.Environment
+	transcript []string
+}
+
+// Start starts the repl
+// It scans the input line by line, and writes everything to out
+// Lines are collected until the brackets are balanced and the strings
+//  are terminated, so a function can span multiple lines
 func Start(in io.Reader, out io.Writer) {
 	scanner := bufio.NewScanner(in)
+	s := &session{out: out, mode: EvalMode, env: object.NewEnvironment()}
+
+	var lines []string
+	blank := 0
 
 	for {
-		fmt.Printf(PROMPT)
+		if len(lines) == 0 {
+			fmt.Fprint(out, PROMPT)
+		} else {
+			fmt.Fprint(out, CONTINUATION_PROMPT)
+		}
+
 		scanned := scanner.Scan()
 		if !scanned {
 			return
 		}
 
 		line := scanner.Text()
-		l := lexer.New(line)
 
-		for tkn := l.NextToken(); tkn.Type != token.EOF; tkn = l.NextToken() {
-			fmt.Printf(`%+v\n`, tkn)
+		// Commands are only accepted on the first line
+		if len(lines) == 0 && strings.HasPrefix(strings.TrimSpace(line), ":") {
+			s.command(strings.TrimSpace(line))
+			continue
+		}
+
+		lines = append(lines, line)
+		input := strings.Join(lines, "\n")
+
+		// Two blank lines submit an incomplete input, so the user can
+		//  see what is wrong with it
+		if strings.TrimSpace(line) == "" {
+			blank += 1
+		} else {
+			blank = 0
+		}
+
+		if isIncomplete(input) && blank < 2 {
+			continue
+		}
+
+		lines = nil
+		blank = 0
+		s.handle(input)
+	}
+}
+
+// isIncomplete checks if the input has unclosed brackets, strings or
+//  block comments
+func isIncomplete(input string) bool {
+	l := lexer.New(input)
+	depth := 0
+
+	for tkn := l.NextToken(); tkn.Type != token.EOF; tkn = l.NextToken() {
+		switch tkn.Type {
+		case token.LBRACE, token.LPAREN, token.LBRACKET:
+			depth += 1
+		case token.RBRACE, token.RPAREN, token.RBRACKET:
+			depth -= 1
+		}
+	}
+
+	for _, d := range l.Errors() {
+		if d.Code == diagnostic.ErrUnterminatedString || d.Code == diagnostic.ErrUnterminatedComment {
+			return true
+		}
+	}
+
+	return depth > 0
+}
+
+// handle processes a complete input in the current mode
+func (s *session) handle(input string) {
+	if strings.TrimSpace(input) == "" {
+		return
+	}
+
+	switch s.mode {
+	case TokensMode:
+		s.printTokens(input)
+	case ASTMode:
+		s.printAST(input)
+	default:
+		s.eval(input)
+	}
+}
+
+// command runs a repl command, that starts with a colon
+func (s *session) command(line string) {
+	fields := strings.Fields(line)
+	cmd, args := fields[0], fields[1:]
+
+	if mode, ok := modes[cmd]; ok && len(args) == 0 {
+		s.mode = mode
+		return
+	}
+
+	switch {
+	case cmd == ":env" && len(args) == 0:
+		s.printEnv()
+	case cmd == ":reset" && len(args) == 0:
+		s.env = object.NewEnvironment()
+		s.transcript = nil
+	case cmd == ":save" && len(args) == 1:
+		s.save(args[0])
+	case cmd == ":load" && len(args) == 1:
+		s.load(args[0])
+	default:
+		fmt.Fprintf(s.out, "Unknown command %s, use :eval, :ast, :tokens, :env, :reset, :save <file> or :load <file>\n", line)
+	}
+}
+
+// eval evaluates the input in the session environment, and prints the
+//  result unless it is null
+// Inputs that parse are added to the transcript, unless they fail
+//  without binding a name, so replaying it gives the same environment
+func (s *session) eval(input string) {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+
+	if errors := p.Errors(); len(errors) > 0 {
+		s.printErrors(input, errors)
+		return
+	}
+
+	before := s.bindings()
+	evaluated := evaluator.Eval(program, s.env)
+	if _, failed := evaluated.(*object.Error); !failed || s.changed(before) {
+		s.transcript = append(s.transcript, input)
+	}
+
+	if evaluated != nil && evaluated != evaluator.NULL {
+		fmt.Fprintln(s.out, evaluated.Inspect())
+	}
+}
+
+// bindings returns the values bound in the session environment
+func (s *session) bindings() map[string]object.Object {
+	bindings := map[string]object.Object{}
+	for _, name := range s.env.Names() {
+		bindings[name], _ = s.env.Get(name)
+	}
+
+	return bindings
+}
+
+// changed checks if a name was bound since the bindings were taken
+func (s *session) changed(before map[string]object.Object) bool {
+	for name, val := range s.bindings() {
+		if prev, ok := before[name]; !ok || prev != val {
+			return true
 		}
 	}
+
+	return false
+}
+
+// printEnv prints the bindings of the session, sorted by name
+func (s *session) printEnv() {
+	for _, name := range s.env.Names() {
+		val, _ := s.env.Get(name)
+		fmt.Fprintf(s.out, "%s = %s\n", name, val.Inspect())
+	}
+}
+
+// save writes the transcript to a file, one input per line
+func (s *session) save(filename string) {
+	content := strings.Join(s.transcript, "\n")
+	if content != "" {
+		content += "\n"
+	}
+
+	if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+		fmt.Fprintf(s.out, "Could not save the session: %v\n", err)
+		return
+	}
+
+	fmt.Fprintf(s.out, "Saved %d inputs to %s\n", len(s.transcript), filename)
+}
+
+// load replays a saved transcript, or any script, in the session
+// Every input is evaluated on its own, like it was typed, so an error
+//  or a return does not stop the inputs after it
+func (s *session) load(filename string) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		fmt.Fprintf(s.out, "Could not load the session: %v\n", err)
+		return
+	}
+
+	for _, input := range splitInputs(string(b)) {
+		s.eval(input)
+	}
+}
+
+// splitInputs splits a file into inputs, the same way lines are
+//  collected in the repl
+func splitInputs(content string) []string {
+	var inputs, lines []string
+
+	for _, line := range strings.Split(content, "\n") {
+		if len(lines) == 0 && strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		lines = append(lines, line)
+		if input := strings.Join(lines, "\n"); !isIncomplete(input) {
+			inputs = append(inputs, input)
+			lines = nil
+		}
+	}
+
+	if len(lines) > 0 {
+		inputs = append(inputs, strings.Join(lines, "\n"))
+	}
+
+	return inputs
+}
+
+// printTokens prints the tokens of the input, one per line
+func (s *session) printTokens(input string) {
+	l := lexer.New(input)
+
+	for tkn := l.NextToken(); tkn.Type != token.EOF; tkn = l.NextToken() {
+		fmt.Fprintf(s.out, "%s\t%s\t%q\n", tkn.Pos, tkn.Type, tkn.Literal)
+	}
+
+	s.printErrors(input, l.Errors())
+}
+
+// printAST parses the input and prints the program, or the errors
+func (s *session) printAST(input string) {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+
+	if errors := p.Errors(); len(errors) > 0 {
+		s.printErrors(input, errors)
+		return
+	}
+
+	fmt.Fprintln(s.out, program.String())
+}
+
+// printErrors renders the diagnostics with the input line
+func (s *session) printErrors(input string, errors []diagnostic.Diagnostic) {
+	for _, d := range errors {
+		diagnostic.Render(s.out, input, d)
+	}
 }
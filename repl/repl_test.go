@@ -0,0 +1,154 @@
+package repl
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testRepl(input string) string {
+	var out bytes.Buffer
+	Start(strings.NewReader(input), &out)
+
+	return out.String()
+}
+
+func TestAST(t *testing.T) {
+	output := testRepl(":ast\nlet x = 1 + 2 * 3;\n\n-a * b\n")
+	expected := ">> >> let x = (1 + (2 * 3));\n>> >> ((-a) * b)\n>> "
+
+	if output != expected {
+		t.Errorf("Found %q, while expecting %q", output, expected)
+	}
+}
+
+func TestParserErrors(t *testing.T) {
+	output := testRepl("let x = 1 +\n")
+	expected := ">> 1:12: error[E204]: Unexpected end of input, while expecting an expression\n" +
+		" 1 | let x = 1 +\n" +
+		"   |            ^\n" +
+		"   = hint: the statement is incomplete\n" +
+		">> "
+
+	if output != expected {
+		t.Errorf("Found %q, while expecting %q", output, expected)
+	}
+}
+
+func TestModes(t *testing.T) {
+	output := testRepl(":tokens\nlet x\n:ast\nx + 1\n:eval\n1 + 1\n:unknown\n")
+	expected := ">> >> 1:1\tLET\t\"let\"\n1:5\tIDENT\t\"x\"\n>> >> (x + 1)\n>> >> 2\n>> Unknown command :unknown, use :eval, :ast, :tokens, :env, :reset, :save <file> or :load <file>\n>> "
+
+	if output != expected {
+		t.Errorf("Found %q, while expecting %q", output, expected)
+	}
+}
+
+func TestMultilineInput(t *testing.T) {
+	input := `let add = fn(x, y) {
+  x + y
+};
+add(1,
+  2)
+[1,
+  2]
+let s = "first
+second"
+/* long
+comment */ s
+`
+	output := testRepl(":ast\n" + input)
+	expected := ">> >> .. .. let add = fn(x, y) { (x + y) };\n" +
+		">> .. add(1, 2)\n" +
+		">> .. [1, 2]\n" +
+		">> .. let s = \"first\nsecond\";\n" +
+		">> .. s\n" +
+		">> "
+
+	if output != expected {
+		t.Errorf("Found %q, while expecting %q", output, expected)
+	}
+}
+
+func TestIncompleteInputSubmittedAfterBlankLines(t *testing.T) {
+	output := testRepl("if (x) {\n\n\nx\n")
+	expected := ">> .. .. 3:1: error[E204]: Unexpected end of input, while expecting }\n" +
+		" 3 | \n" +
+		"   | ^\n" +
+		"   = hint: the block opened at 1:8 is not closed\n" +
+		">> Error: Identifier not found: x\n>> "
+
+	if output != expected {
+		t.Errorf("Found %q, while expecting %q", output, expected)
+	}
+}
+
+func TestSessionEnvironment(t *testing.T) {
+	output := testRepl("let x = 5;\nx * 2\nlet double = fn(n) { n * 2 };\ndouble(x)\n:env\n:reset\n:env\nx\n")
+	expected := ">> >> 10\n>> >> 10\n" +
+		">> double = fn(n) { (n * 2) }\nx = 5\n" +
+		">> >> >> Error: Identifier not found: x\n>> "
+
+	if output != expected {
+		t.Errorf("Found %q, while expecting %q", output, expected)
+	}
+}
+
+func TestSaveAndLoad(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "session.mk")
+
+	output := testRepl("let x = 5;\nlet = 1\nlet y = fn(n) {\n  n + x\n};\n:save " + filename + "\n")
+	if !strings.Contains(output, "Saved 2 inputs to "+filename) {
+		t.Fatalf("Found %q, while expecting the session to be saved", output)
+	}
+
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "let x = 5;\nlet y = fn(n) {\n  n + x\n};\n"
+	if string(b) != expected {
+		t.Errorf("Found %q, while expecting %q", string(b), expected)
+	}
+
+	output = testRepl(":load " + filename + "\ny(1)\n:load missing.mk\n")
+	if !strings.HasPrefix(output, ">> >> 6\n>> Could not load the session: ") {
+		t.Errorf("Found %q, while expecting the session to be replayed", output)
+	}
+
+	// An input that binds a name before it fails is saved, so loading
+	//  it binds the name again
+	output = testRepl("let x = 5; 1 / 0\n:save " + filename + "\n")
+	if !strings.Contains(output, "Saved 1 inputs to "+filename) {
+		t.Fatalf("Found %q, while expecting the failing input to be saved", output)
+	}
+
+	output = testRepl(":load " + filename + "\nx\n")
+	expected = ">> Error: Division by zero: 1 / 0\n>> 5\n>> "
+	if output != expected {
+		t.Errorf("Found %q, while expecting %q", output, expected)
+	}
+}
+
+func TestLoadReplaysEveryInput(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "session.mk")
+
+	output := testRepl("let x = 5;\nnope;\nlet y = x * 2;\n:save " + filename + "\n")
+	if !strings.Contains(output, "Saved 2 inputs to "+filename) {
+		t.Fatalf("Found %q, while expecting only the inputs without errors to be saved", output)
+	}
+
+	script := filepath.Join(t.TempDir(), "script.mk")
+	if err := os.WriteFile(script, []byte("let a = 1;\nreturn a;\nnope;\n\nlet b = fn() {\n  a + 1\n};\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	output = testRepl(":load " + filename + "\ny\n:load " + script + "\nb()\n")
+	expected := ">> >> 10\n>> 1\nError: Identifier not found: nope\n>> 2\n>> "
+	if output != expected {
+		t.Errorf("Found %q, while expecting %q", output, expected)
+	}
+}
@@ -0,0 +1,37 @@
+package token
+
+import (
+	"fmt"
+)
+
+// Position describes a location in the source
+// The zero value has no line and is not valid
+type Position struct {
+	Filename string `json:"filename,omitempty"`
+	Offset   int    `json:"offset"` // Byte offset, starting at 0
+	Line     int    `json:"line"`   // Line number, starting at 1
+	Column   int    `json:"column"` // Column number in runes, starting at 1
+}
+
+// IsValid checks if the position was set by the lexer
+func (pos Position) IsValid() bool {
+	return pos.Line > 0
+}
+
+// String returns the position as file:line:col
+// The filename is omitted when it is empty, and the whole
+//  position is `-` when it is not valid
+func (pos Position) String() string {
+	if !pos.IsValid() {
+		if pos.Filename != "" {
+			return pos.Filename
+		}
+		return "-"
+	}
+
+	if pos.Filename == "" {
+		return fmt.Sprintf("%d:%d", pos.Line, pos.Column)
+	}
+
+	return fmt.Sprintf("%s:%d:%d", pos.Filename, pos.Line, pos.Column)
+}
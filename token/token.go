@@ -1,24 +1,34 @@
 package token
 
-// TODO: Add io.Reader and filename
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
 
 type TokenType string
 
 type Token struct {
-	Type    TokenType
-	Literal string
+	Type    TokenType `json:"type"`
+	Literal string    `json:"literal"`
+
+	// Pos is the position of the first character of the token
+	Pos Position `json:"pos"`
 
-	Filename string
-	Row      string
-	Column   string
+	// Leading holds the comments before the token, when the lexer
+	//  attaches comments as trivia
+	Leading []Token `json:"leading,omitempty"`
 }
 
 const (
 	ILLEGAL = "ILLEGAL"
 	EOF     = "EOF"
+	COMMENT = "COMMENT"
 
-	IDENT = "IDENT"
-	INT   = "INT"
+	IDENT  = "IDENT"
+	INT    = "INT"
+	FLOAT  = "FLOAT"
+	STRING = "STRING"
 
 	ASSIGN   = "="
 	PLUS     = "+"
@@ -32,6 +42,9 @@ const (
 	EQ     = "=="
 	NOT_EQ = "!="
 
+	AND = "&&"
+	OR  = "||"
+
 	COMMA     = ","
 	SEMICOLON = ";"
 
@@ -40,6 +53,11 @@ const (
 	LBRACE = "{"
 	RBRACE = "}"
 
+	LBRACKET = "["
+	RBRACKET = "]"
+
+	COLON = ":"
+
 	FUNCTION = "FUNCTION"
 	LET      = "LET"
 	TRUE     = "TRUE"
@@ -70,3 +88,33 @@ func LookupIdent(ident string) TokenType {
 
 	return IDENT
 }
+
+// FormatFloat formats a float as the shortest literal that reads back
+//  as the same value
+// Whole floats get a fraction, so they are not read as integers
+func FormatFloat(f float64) string {
+	s := strconv.FormatFloat(f, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eIN") {
+		s += ".0"
+	}
+
+	return s
+}
+
+// End returns the position right after the last character of the token
+// Strings and block comments can span multiple lines, so the line moves
+//  past every new line, and the column starts over after the last one
+func (t Token) End() Position {
+	end := t.Pos
+	end.Offset += len(t.Literal)
+
+	if i := strings.LastIndexByte(t.Literal, '\n'); i >= 0 {
+		end.Line += strings.Count(t.Literal, "\n")
+		end.Column = 1 + utf8.RuneCountInString(t.Literal[i+1:])
+		return end
+	}
+
+	end.Column += utf8.RuneCountInString(t.Literal)
+
+	return end
+}
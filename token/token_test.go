@@ -0,0 +1,24 @@
+package token
+
+import (
+	"testing"
+)
+
+func TestFormatFloat(t *testing.T) {
+	tests := []struct {
+		input    float64
+		expected string
+	}{
+		{3.14, "3.14"},
+		{3, "3.0"},
+		{1e-9, "1e-09"},
+		{1e21, "1e+21"},
+		{0.30000000000000004, "0.30000000000000004"},
+	}
+
+	for _, tt := range tests {
+		if out := FormatFloat(tt.input); out != tt.expected {
+			t.Errorf("Found %q, while expecting %q", out, tt.expected)
+		}
+	}
+}
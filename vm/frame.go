@@ -0,0 +1,25 @@
+package vm
+
+import (
+	"github.com/shavit/go-interpreter/code"
+	"github.com/shavit/go-interpreter/object"
+)
+
+// Frame is a call of a closure
+// The locals of the call are stored on the stack, from the base pointer
+type Frame struct {
+	cl          *object.Closure
+	ip          int // The offset of the current instruction
+	basePointer int
+}
+
+// NewFrame creates the frame of a call, that starts before the first
+//  instruction
+func NewFrame(cl *object.Closure, basePointer int) *Frame {
+	return &Frame{cl: cl, ip: -1, basePointer: basePointer}
+}
+
+// Instructions returns the instructions of the called function
+func (f *Frame) Instructions() code.Instructions {
+	return f.cl.Fn.Instructions
+}
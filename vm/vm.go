@@ -0,0 +1,559 @@
+// Package vm runs the bytecode of the compiler on a stack machine
+//
+// The values and the runtime errors are the same as the ones of the
+//  evaluator, so a program prints the same in both engines, except for
+//  the closures that use the locals of outer functions, as described in
+//  the compiler package
+package vm
+
+import (
+	"fmt"
+
+	"github.com/shavit/go-interpreter/code"
+	"github.com/shavit/go-interpreter/compiler"
+	"github.com/shavit/go-interpreter/object"
+)
+
+// Limits of the virtual machine
+// The operands of the global instructions are two bytes wide, so there
+//  cannot be more globals
+const (
+	StackSize   = 1 << 16
+	GlobalsSize = 1 << 16
+	MaxFrames   = 1 << 14
+)
+
+// Booleans and null never change, so there is no need to allocate
+//  new objects for them
+var (
+	NULL  = &object.Null{}
+	TRUE  = &object.Boolean{Value: true}
+	FALSE = &object.Boolean{Value: false}
+)
+
+// VM runs a compiled program
+type VM struct {
+	constants   []object.Object
+	globals     []object.Object
+	globalNames []string
+
+	stack []object.Object
+	sp    int // The next free slot, the top of the stack is sp-1
+
+	frames      []*Frame
+	framesIndex int
+}
+
+// New creates a virtual machine for the bytecode of a program
+// The program runs as the body of a closure in the main frame
+func New(bytecode *compiler.Bytecode) *VM {
+	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions}
+	mainFrame := NewFrame(&object.Closure{Fn: mainFn}, 0)
+
+	frames := make([]*Frame, MaxFrames)
+	frames[0] = mainFrame
+
+	return &VM{
+		constants:   bytecode.Constants,
+		globals:     make([]object.Object, GlobalsSize),
+		globalNames: bytecode.GlobalNames,
+		stack:       make([]object.Object, StackSize),
+		frames:      frames,
+		framesIndex: 1,
+	}
+}
+
+// Result returns the value of the program
+// It is the value of the last expression statement, or the value of a
+//  return statement, that is the last value popped from the stack
+func (vm *VM) Result() object.Object {
+	return vm.stack[vm.sp]
+}
+
+func (vm *VM) currentFrame() *Frame {
+	return vm.frames[vm.framesIndex-1]
+}
+
+func (vm *VM) pushFrame(f *Frame) error {
+	if vm.framesIndex >= MaxFrames {
+		return fmt.Errorf("Stack overflow: more than %d calls", MaxFrames)
+	}
+
+	vm.frames[vm.framesIndex] = f
+	vm.framesIndex += 1
+
+	return nil
+}
+
+func (vm *VM) popFrame() *Frame {
+	vm.framesIndex -= 1
+	return vm.frames[vm.framesIndex]
+}
+
+// Run executes the instructions until the end of the program, a return
+//  statement outside of a function, or a runtime error
+func (vm *VM) Run() error {
+	var ip int
+	var ins code.Instructions
+	var op code.Opcode
+
+	for vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
+		vm.currentFrame().ip += 1
+
+		ip = vm.currentFrame().ip
+		ins = vm.currentFrame().Instructions()
+		op = code.Opcode(ins[ip])
+
+		var err error
+
+		switch op {
+		case code.OpConstant:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+			err = vm.push(vm.constants[constIndex])
+
+		case code.OpPop:
+			vm.pop()
+
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv,
+			code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpLessThan:
+			err = vm.executeInfixOperation(op)
+
+		case code.OpMinus:
+			err = vm.executeMinusOperator()
+
+		case code.OpBang:
+			err = vm.push(nativeBoolToBooleanObject(!isTruthy(vm.pop())))
+
+		case code.OpTrue:
+			err = vm.push(TRUE)
+		case code.OpFalse:
+			err = vm.push(FALSE)
+		case code.OpNull:
+			err = vm.push(NULL)
+
+		case code.OpJump:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip = pos - 1
+
+		case code.OpJumpNotTruthy:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			if !isTruthy(vm.pop()) {
+				vm.currentFrame().ip = pos - 1
+			}
+
+		case code.OpSetGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+			vm.globals[globalIndex] = vm.pop()
+
+		case code.OpGetGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+			err = vm.pushBinding(vm.globals[globalIndex], vm.globalNames, int(globalIndex))
+
+		case code.OpSetLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+			frame := vm.currentFrame()
+			vm.stack[frame.basePointer+int(localIndex)] = vm.pop()
+
+		case code.OpGetLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+			frame := vm.currentFrame()
+			err = vm.pushBinding(vm.stack[frame.basePointer+int(localIndex)], frame.cl.Fn.LocalNames, int(localIndex))
+
+		case code.OpGetFree:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+			err = vm.push(vm.currentFrame().cl.Free[freeIndex])
+
+		case code.OpCurrentClosure:
+			err = vm.push(vm.currentFrame().cl)
+
+		case code.OpClosure:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			numFree := code.ReadUint8(ins[ip+3:])
+			vm.currentFrame().ip += 3
+			err = vm.pushClosure(int(constIndex), int(numFree))
+
+		case code.OpCall:
+			numArgs := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+			err = vm.callFunction(int(numArgs))
+
+		case code.OpArray:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			elements := make([]object.Object, numElements)
+			copy(elements, vm.stack[vm.sp-numElements:vm.sp])
+			vm.sp -= numElements
+			err = vm.push(&object.Array{Elements: elements})
+
+		case code.OpHash:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			err = vm.pushHash(numElements)
+
+		case code.OpIndex:
+			index := vm.pop()
+			left := vm.pop()
+			err = vm.executeIndexExpression(left, index)
+
+		case code.OpReturnValue, code.OpReturn:
+			returnValue := object.Object(NULL)
+			if op == code.OpReturnValue {
+				returnValue = vm.pop()
+			}
+
+			// A return statement outside of a function ends the program,
+			//  and leaves the value where Result finds it
+			if vm.framesIndex == 1 {
+				vm.stack[vm.sp] = returnValue
+				return nil
+			}
+
+			frame := vm.popFrame()
+			vm.sp = frame.basePointer - 1
+			err = vm.push(returnValue)
+
+		default:
+			def, lookupErr := code.Lookup(byte(op))
+			if lookupErr != nil {
+				return lookupErr
+			}
+			return fmt.Errorf("Unhandled opcode %s", def.Name)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// push adds a value to the top of the stack
+func (vm *VM) push(obj object.Object) error {
+	if vm.sp >= StackSize {
+		return fmt.Errorf("Stack overflow: more than %d values", StackSize)
+	}
+
+	vm.stack[vm.sp] = obj
+	vm.sp += 1
+
+	return nil
+}
+
+// pop removes the value at the top of the stack
+// The value stays in its slot until it is overwritten, so Result can
+//  find the last popped value
+func (vm *VM) pop() object.Object {
+	obj := vm.stack[vm.sp-1]
+	vm.sp -= 1
+
+	return obj
+}
+
+// callFunction calls the closure below the arguments
+// The arguments become the first locals of the frame, and the slots
+//  of the other locals are reserved above them
+func (vm *VM) callFunction(numArgs int) error {
+	callee := vm.stack[vm.sp-1-numArgs]
+
+	cl, ok := callee.(*object.Closure)
+	if !ok {
+		return fmt.Errorf("Not a function: %s", callee.Type())
+	}
+
+	if numArgs != cl.Fn.NumParameters {
+		return fmt.Errorf("Wrong number of arguments: found %d, while expecting %d", numArgs, cl.Fn.NumParameters)
+	}
+
+	frame := NewFrame(cl, vm.sp-numArgs)
+	if vm.sp+cl.Fn.NumLocals >= StackSize {
+		return fmt.Errorf("Stack overflow: more than %d values", StackSize)
+	}
+	if err := vm.pushFrame(frame); err != nil {
+		return err
+	}
+
+	// Clear the locals of the previous calls, so a let statement that
+	//  did not run leaves its slot unset
+	for i := vm.sp; i < frame.basePointer+cl.Fn.NumLocals; i++ {
+		vm.stack[i] = nil
+	}
+	vm.sp = frame.basePointer + cl.Fn.NumLocals
+
+	return nil
+}
+
+// pushBinding pushes the value of a global or a local
+// The slot is unset when the let statement of the name did not run, for
+//  example in a branch that was not taken
+func (vm *VM) pushBinding(value object.Object, names []string, index int) error {
+	if value == nil {
+		name := "?"
+		if index < len(names) {
+			name = names[index]
+		}
+		return fmt.Errorf("Identifier not found: %s", name)
+	}
+
+	return vm.push(value)
+}
+
+// pushClosure creates a closure of a function constant, with the free
+//  variables at the top of the stack
+func (vm *VM) pushClosure(constIndex, numFree int) error {
+	constant := vm.constants[constIndex]
+
+	function, ok := constant.(*object.CompiledFunction)
+	if !ok {
+		return fmt.Errorf("Not a function: %s", constant.Type())
+	}
+
+	free := make([]object.Object, numFree)
+	copy(free, vm.stack[vm.sp-numFree:vm.sp])
+	vm.sp -= numFree
+
+	return vm.push(&object.Closure{Fn: function, Free: free})
+}
+
+// Operators of the infix opcodes, for the error messages
+var infixOperators = map[code.Opcode]string{
+	code.OpAdd:         "+",
+	code.OpSub:         "-",
+	code.OpMul:         "*",
+	code.OpDiv:         "/",
+	code.OpEqual:       "==",
+	code.OpNotEqual:    "!=",
+	code.OpGreaterThan: ">",
+	code.OpLessThan:    "<",
+}
+
+// executeInfixOperation applies an infix operator on the two values at
+//  the top of the stack
+func (vm *VM) executeInfixOperation(op code.Opcode) error {
+	right := vm.pop()
+	left := vm.pop()
+	operator := infixOperators[op]
+
+	switch {
+	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
+		return vm.executeIntegerOperation(op, left, right)
+	case isNumber(left) && isNumber(right):
+		return vm.executeFloatOperation(op, left, right)
+	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
+		return vm.executeStringOperation(op, left, right)
+	case left.Type() != right.Type():
+		return fmt.Errorf("Type mismatch: %s %s %s", left.Type(), operator, right.Type())
+	// Booleans and null are singletons, so they can be compared by
+	//  their pointers
+	case op == code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(left == right))
+	case op == code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(left != right))
+	default:
+		return fmt.Errorf("Unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+// executeIntegerOperation applies arithmetic and comparison operators
+//  on two integers
+func (vm *VM) executeIntegerOperation(op code.Opcode, left, right object.Object) error {
+	leftVal := left.(*object.Integer).Value
+	rightVal := right.(*object.Integer).Value
+
+	switch op {
+	case code.OpAdd:
+		return vm.push(&object.Integer{Value: leftVal + rightVal})
+	case code.OpSub:
+		return vm.push(&object.Integer{Value: leftVal - rightVal})
+	case code.OpMul:
+		return vm.push(&object.Integer{Value: leftVal * rightVal})
+	case code.OpDiv:
+		if rightVal == 0 {
+			return fmt.Errorf("Division by zero: %d / %d", leftVal, rightVal)
+		}
+		return vm.push(&object.Integer{Value: leftVal / rightVal})
+	case code.OpGreaterThan:
+		return vm.push(nativeBoolToBooleanObject(leftVal > rightVal))
+	case code.OpLessThan:
+		return vm.push(nativeBoolToBooleanObject(leftVal < rightVal))
+	case code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(leftVal == rightVal))
+	case code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(leftVal != rightVal))
+	default:
+		return fmt.Errorf("Unknown operator: %s %s %s", left.Type(), infixOperators[op], right.Type())
+	}
+}
+
+// executeFloatOperation applies arithmetic and comparison operators on
+//  two numbers, where at least one is a float
+// The integer is converted to a float, so the result is a float
+func (vm *VM) executeFloatOperation(op code.Opcode, left, right object.Object) error {
+	leftVal := toFloat(left)
+	rightVal := toFloat(right)
+
+	switch op {
+	case code.OpAdd:
+		return vm.push(&object.Float{Value: leftVal + rightVal})
+	case code.OpSub:
+		return vm.push(&object.Float{Value: leftVal - rightVal})
+	case code.OpMul:
+		return vm.push(&object.Float{Value: leftVal * rightVal})
+	case code.OpDiv:
+		if rightVal == 0 {
+			return fmt.Errorf("Division by zero: %s / %s", left.Inspect(), right.Inspect())
+		}
+		return vm.push(&object.Float{Value: leftVal / rightVal})
+	case code.OpGreaterThan:
+		return vm.push(nativeBoolToBooleanObject(leftVal > rightVal))
+	case code.OpLessThan:
+		return vm.push(nativeBoolToBooleanObject(leftVal < rightVal))
+	case code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(leftVal == rightVal))
+	case code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(leftVal != rightVal))
+	default:
+		return fmt.Errorf("Unknown operator: %s %s %s", left.Type(), infixOperators[op], right.Type())
+	}
+}
+
+// executeStringOperation concatenates and compares two strings
+func (vm *VM) executeStringOperation(op code.Opcode, left, right object.Object) error {
+	leftVal := left.(*object.String).Value
+	rightVal := right.(*object.String).Value
+
+	switch op {
+	case code.OpAdd:
+		return vm.push(&object.String{Value: leftVal + rightVal})
+	case code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(leftVal == rightVal))
+	case code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(leftVal != rightVal))
+	default:
+		return fmt.Errorf("Unknown operator: %s %s %s", left.Type(), infixOperators[op], right.Type())
+	}
+}
+
+// pushHash replaces the keys and values at the top of the stack with a
+//  hash of them
+// Later pairs replace the values of duplicate keys
+func (vm *VM) pushHash(numElements int) error {
+	hash := object.NewHash()
+
+	for i := vm.sp - numElements; i < vm.sp; i += 2 {
+		key := vm.stack[i]
+
+		hashable, ok := key.(object.Hashable)
+		if !ok {
+			return fmt.Errorf("Unusable as hash key: %s", key.Type())
+		}
+
+		hash.Set(hashable, vm.stack[i+1])
+	}
+	vm.sp -= numElements
+
+	return vm.push(hash)
+}
+
+// executeIndexExpression pushes the element of an array or the value
+//  of a hash key
+func (vm *VM) executeIndexExpression(left, index object.Object) error {
+	switch left := left.(type) {
+	case *object.Array:
+		return vm.executeArrayIndex(left, index)
+	case *object.Hash:
+		return vm.executeHashIndex(left, index)
+	default:
+		return fmt.Errorf("Index operator not supported: %s", left.Type())
+	}
+}
+
+// executeHashIndex pushes the value of a key, or null for missing keys
+func (vm *VM) executeHashIndex(hash *object.Hash, index object.Object) error {
+	key, ok := index.(object.Hashable)
+	if !ok {
+		return fmt.Errorf("Unusable as hash key: %s", index.Type())
+	}
+
+	value, ok := hash.Get(key)
+	if !ok {
+		return vm.push(NULL)
+	}
+
+	return vm.push(value)
+}
+
+// executeArrayIndex pushes the element of an array at an index
+// Negative indices count from the end of the array
+func (vm *VM) executeArrayIndex(array *object.Array, index object.Object) error {
+	integer, ok := index.(*object.Integer)
+	if !ok {
+		return fmt.Errorf("Index must be an integer: %s", index.Type())
+	}
+
+	i, length := integer.Value, int64(len(array.Elements))
+	if i < 0 {
+		i += length
+	}
+	if i < 0 || i >= length {
+		return fmt.Errorf("Index out of range: %d, the array has %d elements", integer.Value, length)
+	}
+
+	return vm.push(array.Elements[i])
+}
+
+// executeMinusOperator negates the number at the top of the stack
+func (vm *VM) executeMinusOperator() error {
+	switch operand := vm.pop().(type) {
+	case *object.Integer:
+		return vm.push(&object.Integer{Value: -operand.Value})
+	case *object.Float:
+		return vm.push(&object.Float{Value: -operand.Value})
+	default:
+		return fmt.Errorf("Unknown operator: -%s", operand.Type())
+	}
+}
+
+// nativeBoolToBooleanObject returns one of the boolean singletons
+func nativeBoolToBooleanObject(input bool) *object.Boolean {
+	if input {
+		return TRUE
+	}
+
+	return FALSE
+}
+
+// isNumber checks if the object is an integer or a float
+func isNumber(obj object.Object) bool {
+	return obj.Type() == object.INTEGER_OBJ || obj.Type() == object.FLOAT_OBJ
+}
+
+// toFloat converts a number to a float
+func toFloat(obj object.Object) float64 {
+	if integer, ok := obj.(*object.Integer); ok {
+		return float64(integer.Value)
+	}
+
+	return obj.(*object.Float).Value
+}
+
+// isTruthy checks if a value is considered true
+// Only false and null are falsy
+func isTruthy(obj object.Object) bool {
+	switch obj {
+	case NULL, FALSE:
+		return false
+	default:
+		return true
+	}
+}
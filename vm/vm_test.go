@@ -0,0 +1,315 @@
+package vm
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/shavit/go-interpreter/ast"
+	"github.com/shavit/go-interpreter/compiler"
+	"github.com/shavit/go-interpreter/evaluator"
+	"github.com/shavit/go-interpreter/lexer"
+	"github.com/shavit/go-interpreter/object"
+	"github.com/shavit/go-interpreter/parser"
+)
+
+func parse(t testing.TB, input string) *ast.Program {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+
+	if errors := p.Errors(); len(errors) > 0 {
+		t.Fatalf("Found parser errors %v for %q", errors, input)
+	}
+
+	return program
+}
+
+// run compiles and runs a program, and returns its value or the error
+//  as an error object
+func run(t testing.TB, input string) object.Object {
+	comp := compiler.New()
+	if err := comp.Compile(parse(t, input)); err != nil {
+		return &object.Error{Message: err.Error()}
+	}
+
+	vm := New(comp.Bytecode())
+	if err := vm.Run(); err != nil {
+		return &object.Error{Message: err.Error()}
+	}
+
+	return vm.Result()
+}
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"1 + 2 * 3", 7},
+		{"-(4 - 10) / 2", 3},
+		{"1 < 2 == true", true},
+		{"!5", false},
+		{`"foo" + "bar"`, "foobar"},
+		{`"a" != "b"`, true},
+		{"1.5 * 2", 3.0},
+		{"10 / 4.0 - .5", 2.0},
+		{"-1e-1 + 1", 0.9},
+		{"1 == 1.0", true},
+		{"10 / 4", 2},
+		{"if (1 > 2) { 10 }", nil},
+		{"if (false) { 10 } else { 20 }", 20},
+		{"if (if (false) { 1 }) { 10 } else { 20 }", 20},
+		{"let a = 5; let b = a * 2; b", 10},
+		{"let a = 5", nil},
+		{"return 1; 2", 1},
+		{"let f = fn() { return 1; 2 }; f()", 1},
+		{"let f = fn() { }; f()", nil},
+		{"let f = fn(a, b) { let c = a + b; c }; f(1, 2) + f(3, 4)", 10},
+		{"let global = 10; let f = fn(a) { a + global }; f(1)", 11},
+		{"let adder = fn(a) { fn(b) { a + b } }; let addTwo = adder(2); addTwo(3)", 5},
+		{"let f = fn(a) { fn(b) { fn(c) { a + b + c } } }; f(1)(2)(3)", 6},
+		{"let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; fib(15)", 610},
+		{"let f = fn() { let count = fn(n) { if (n == 0) { 0 } else { count(n - 1) } }; count(5) }; f()", 0},
+		{"let sum = fn(n) { if (n == 0) { 0 } else { n + sum(n - 1) } }; sum(5000)", 12502500},
+		{"[1, 2, 3][1]", 2},
+		{"[1, 2, 3][-1]", 3},
+		{"let a = [1, [2, 3]]; a[1][0] + a[0]", 3},
+		{"let f = fn(a, i) { a[i] }; f([4, 5, 6], 1 + 1)", 6},
+		{`[1, "a"][1]`, "a"},
+		{`{"a": 1, 2: 2, true: 3}["a"]`, 1},
+		{`let m = {"a": 1, 2: 2, true: 3}; m[2] + m[true]`, 5},
+		{`{"a": 1}["b"]`, nil},
+		{`let key = fn(k) { "k" + k }; {key("1"): 1, key("2"): 2}["k2"]`, 2},
+		{"true && false", false},
+		{"false || 1", true},
+		{"1 > 2 || 2 > 1 && 3 > 2", true},
+		{"let x = 0; x != 0 && 10 / x > 1", false},
+		{"let f = fn(x) { x == 0 || f(x - 1) }; f(10)", true},
+		{"if (false || false) { 1 }", nil},
+	}
+
+	for _, tt := range tests {
+		testObject(t, tt.input, run(t, tt.input), tt.expected)
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"5 + true", "Type mismatch: INTEGER + BOOLEAN"},
+		{"-true", "Unknown operator: -BOOLEAN"},
+		{"true + false", "Unknown operator: BOOLEAN + BOOLEAN"},
+		{`"a" - "b"`, "Unknown operator: STRING - STRING"},
+		{"10 / 0", "Division by zero: 10 / 0"},
+		{"1.5 / 0", "Division by zero: 1.5 / 0"},
+		{"-true + 1.5", "Unknown operator: -BOOLEAN"},
+		{"missing", "Identifier not found: missing"},
+		{"let x = x", "Identifier not found: x"},
+		{"let f = fn() { g }; f(); let g = 1", "Identifier not found: g"},
+		{"1(2)", "Not a function: INTEGER"},
+		{"fn(a) { a }()", "Wrong number of arguments: found 0, while expecting 1"},
+		{"let f = fn() { f() }; f()", fmt.Sprintf("Stack overflow: more than %d calls", MaxFrames)},
+		{"[1, 2, 3][3]", "Index out of range: 3, the array has 3 elements"},
+		{"[][-1]", "Index out of range: -1, the array has 0 elements"},
+		{"[1][true]", "Index must be an integer: BOOLEAN"},
+		{`"abc"[0]`, "Index operator not supported: STRING"},
+		{`{fn() { }: 1}`, "Unusable as hash key: FUNCTION"},
+		{`{"a": 1}[[]]`, "Unusable as hash key: ARRAY"},
+		{"true && 1 / 0", "Division by zero: 1 / 0"},
+	}
+
+	for _, tt := range tests {
+		result := run(t, tt.input)
+
+		err, ok := result.(*object.Error)
+		if !ok {
+			t.Errorf("Found %#v, while expecting an error for %q", result, tt.input)
+			continue
+		}
+		if err.Message != tt.expected {
+			t.Errorf("Found %q, while expecting %q", err.Message, tt.expected)
+		}
+	}
+}
+
+// The vm prints the same values and errors as the evaluator
+func TestSameAsEvaluator(t *testing.T) {
+	tests := []string{
+		"let add = fn(x, y) { x + y }; add(2, 3) * 2",
+		"fn(x) { x + 1 }",
+		"let total = fn(price, qty) { price * qty }; total(9.99, 3) + 0.1",
+		"let f = fn(x) { if (x > 1) { return x; } 0 }; f(5) + f(1)",
+		`"a" == "a"; 1 == true`,
+		"let x = 1; if (x == 1) { let y = 2 }",
+		"if (true) { }",
+		"null_value",
+		"let counter = fn(x) { if (x > 10) { return true; } else { counter(x + 1) } }; counter(0)",
+		`[1, 2.5, "a", [true, fn(x) { x }], []]`,
+		"let a = [1, 2]; a == a; [1] == [1]",
+		"[1, 2][2]",
+		`{"b": 1, "a": [2], 3: {true: "x"}, "b": 4}`,
+		`{fn() { }: 1 / 0}`,
+		`let m = {}; m == m; {} == {}`,
+		"let f = fn(n) { f(n + 1) }; f(0)",
+		"let x = 0; x != 0 && 10 / x > 1",
+		"let t = fn() { true }; t() || 1 / 0; false || t()",
+		"let f = fn() { false && 1 / 0 }; f() || [][0]",
+		"[1 && 0, false || if (false) { 1 }]",
+		"if (false) { let a = 1 }; a + 1",
+		"let x = 1; if (false) { let x = 2 }; x + 1",
+		"let f = fn(set) { if (set) { let a = 1 }; a }; f(true); f(false)",
+		"let f = fn(x, x) { x }; f(1, 2)",
+		"let g = fn() { h() }; let h = fn() { 1 }; g()",
+		"let x = 1; let f = fn() { x }; let x = 2; f()",
+		"let f = fn() { g }; if (false) { let g = 1 }; f()",
+		"1 + if (true) { return 2 }",
+		"let f = fn() { let a = if (true) { return 2 }; 5 }; f()",
+		"if (if (true) { return false }) { 10 } else { 20 }",
+		"let f = fn(x) { x }; [f(if (true) { return 4 }), {1: 2}[if (true) { return 3 }]]",
+	}
+
+	for _, input := range tests {
+		expected := evaluator.Eval(parse(t, input), object.NewEnvironment())
+		actual := run(t, input)
+
+		if actual.Inspect() != expected.Inspect() {
+			t.Errorf("Found %q, while expecting %q for %q", actual.Inspect(), expected.Inspect(), input)
+		}
+	}
+}
+
+// The closures that use the locals of outer functions are different,
+//  as described in the compiler package
+func TestDifferentFromEvaluator(t *testing.T) {
+	tests := []struct {
+		input     string
+		expected  string
+		evaluated string
+	}{
+		{"fn() { let x = 1; let f = fn() { x }; let x = 2; f() }()", "1", "2"},
+		{"fn() { let g = fn() { h() }; let h = fn() { 1 }; g() }()", "Error: Identifier not found: h", "1"},
+	}
+
+	for _, tt := range tests {
+		if actual := run(t, tt.input).Inspect(); actual != tt.expected {
+			t.Errorf("Found %q, while expecting %q for %q", actual, tt.expected, tt.input)
+		}
+
+		evaluated := evaluator.Eval(parse(t, tt.input), object.NewEnvironment())
+		if evaluated.Inspect() != tt.evaluated {
+			t.Errorf("Found %q, while expecting %q from the evaluator for %q", evaluated.Inspect(), tt.evaluated, tt.input)
+		}
+	}
+}
+
+// The largest functions and calls the instructions can hold run like
+//  in the evaluator
+func TestLimits(t *testing.T) {
+	var body, params, args strings.Builder
+	for i := 0; i < 256; i++ {
+		fmt.Fprintf(&body, "let a%d = %d; ", i, i)
+	}
+	for i := 0; i < 255; i++ {
+		if i > 0 {
+			params.WriteString(", ")
+			args.WriteString(", ")
+		}
+		fmt.Fprintf(&params, "p%d", i)
+		fmt.Fprintf(&args, "%d", i)
+	}
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"fn() { " + body.String() + "a0 + a255 }()", 255},
+		{"fn(" + params.String() + ") { p0 + p254 }(" + args.String() + ")", 254},
+	}
+
+	for _, tt := range tests {
+		testObject(t, tt.input, run(t, tt.input), tt.expected)
+
+		expected := evaluator.Eval(parse(t, tt.input), object.NewEnvironment())
+		testObject(t, tt.input, expected, tt.expected)
+	}
+}
+
+func testObject(t *testing.T, input string, actual object.Object, expected interface{}) {
+	t.Helper()
+
+	switch expected := expected.(type) {
+	case int:
+		integer, ok := actual.(*object.Integer)
+		if !ok || integer.Value != int64(expected) {
+			t.Errorf("Found %#v, while expecting %d for %q", actual, expected, input)
+		}
+	case float64:
+		float, ok := actual.(*object.Float)
+		if !ok || float.Value != expected {
+			t.Errorf("Found %#v, while expecting %g for %q", actual, expected, input)
+		}
+	case bool:
+		if actual != nativeBoolToBooleanObject(expected) {
+			t.Errorf("Found %#v, while expecting %t for %q", actual, expected, input)
+		}
+	case string:
+		str, ok := actual.(*object.String)
+		if !ok || str.Value != expected {
+			t.Errorf("Found %#v, while expecting %q for %q", actual, expected, input)
+		}
+	case nil:
+		if actual != NULL {
+			t.Errorf("Found %#v, while expecting null for %q", actual, input)
+		}
+	}
+}
+
+// Benchmarks of the vm and the evaluator on the same programs
+// The programs are parsed and compiled once, so only the execution is
+//  measured
+var benchmarks = []struct {
+	name  string
+	input string
+}{
+	{"fibonacci", "let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; fib(20)"},
+	{"sum", "let sum = fn(n, acc) { if (n == 0) { acc } else { sum(n - 1, acc + n) } }; sum(5000, 0)"},
+	{"closures", "let adder = fn(a) { fn(b) { a + b } }; let apply = fn(n) { if (n == 0) { 0 } else { adder(n)(1) + apply(n - 1) } }; apply(2000)"},
+}
+
+func BenchmarkVM(b *testing.B) {
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			comp := compiler.New()
+			if err := comp.Compile(parse(b, bm.input)); err != nil {
+				b.Fatal(err)
+			}
+			bytecode := comp.Bytecode()
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				vm := New(bytecode)
+				if err := vm.Run(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkEvaluator(b *testing.B) {
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			program := parse(b, bm.input)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				result := evaluator.Eval(program, object.NewEnvironment())
+				if result.Type() == object.ERROR_OBJ {
+					b.Fatal(result.Inspect())
+				}
+			}
+		})
+	}
+}